@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bomoko/lagoon-init/internal"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"os"
+	"time"
+)
+
+var pruneOlderThan time.Duration
+var pullAll bool
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local cache of manifests and scaffold repositories",
+	Long:  `Manage the local cache of fetched manifests and mirrors of the git repositories scaffolds are cloned from`,
+}
+
+func repoCache() (*internal.RepoCache, error) {
+	cacheDir, err := internal.DefaultCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return internal.NewRepoCache(cacheDir), nil
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached scaffold repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := repoCache()
+		if err != nil {
+			return err
+		}
+		entries, err := cache.List()
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			fmt.Println("No repositories are cached")
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s (%.1f MB, fetched %s, last used %s)\n", internal.RedactUrl(entry.Url), float64(entry.Size)/(1024*1024),
+				entry.FetchedAt.Format(time.RFC3339), entry.UsedAt.Format(time.RFC3339))
+		}
+
+		cacheDir, err := internal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		index, err := internal.LoadCacheIndex(internal.CacheIndexPath(cacheDir))
+		if err != nil {
+			return err
+		}
+		if len(index.Scaffolds) > 0 {
+			fmt.Println("\nPulled scaffolds:")
+		}
+		for _, entry := range index.Scaffolds {
+			fmt.Printf("%s/%s %s (%s, pulled %s)\n", entry.Catalog, entry.Name, entry.Location, entry.Ref, entry.PulledAt.Format(time.RFC3339))
+		}
+		return nil
+	},
+}
+
+var cachePullCmd = &cobra.Command{
+	Use:     "pull [scaffold...]",
+	Short:   "Fetch scaffolds into the cache, so they can be used offline",
+	Long:    `Resolves the current manifests and fetches each named scaffold (or every scaffold, with --all) at its pinned ref into the cache, so that later runs work with --offline`,
+	Example: "lagoon-scaffold cache pull drupal-9 laravel\nlagoon-scaffold cache pull --all",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !pullAll {
+			return errors.New("name the scaffolds to pull, or pass --all")
+		}
+		sources, err := manifestSources()
+		if err != nil {
+			return err
+		}
+		options, err := manifestOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		options.Refresh = !offline
+		scaffolds, err := internal.GetScaffolds(sources, options)
+		if err != nil {
+			return err
+		}
+
+		names := args
+		if pullAll {
+			names = getScaffoldsKeys(scaffolds)
+		}
+		var toPull []internal.ScaffoldRepo
+		for _, name := range names {
+			repo, ok := internal.FindScaffold(scaffolds, name)
+			if !ok {
+				return fmt.Errorf("Scaffold `%v` does not exist", name)
+			}
+			toPull = append(toPull, repo)
+		}
+
+		cacheDir, err := internal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		index, err := internal.LoadCacheIndex(internal.CacheIndexPath(cacheDir))
+		if err != nil {
+			return err
+		}
+		sourceOptions, err := sourceOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+
+		failed := 0
+		for _, repo := range toPull {
+			entry, err := internal.PullScaffold(repo, sourceOptions)
+			if err != nil {
+				fmt.Println(err)
+				failed++
+				continue
+			}
+			index.Add(entry)
+			fmt.Printf("Pulled %s/%s from %s\n", entry.Catalog, entry.Name, entry.Location)
+		}
+		if err = index.Save(internal.CacheIndexPath(cacheDir)); err != nil {
+			return err
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d scaffolds could not be pulled", failed, len(toPull))
+		}
+		return nil
+	},
+}
+
+var cacheExportCmd = &cobra.Command{
+	Use:   "export <file.tar.gz>",
+	Short: "Export the whole cache as a single archive",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir, err := internal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err = internal.ExportCache(cacheDir, f); err != nil {
+			os.Remove(args[0])
+			return err
+		}
+		fmt.Printf("Exported %s to %s\n", cacheDir, args[0])
+		return nil
+	},
+}
+
+var cacheImportCmd = &cobra.Command{
+	Use:   "import <file.tar.gz>",
+	Short: "Import a cache exported with `cache export`",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir, err := internal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		index, err := internal.ImportCache(cacheDir, f)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %s - %d scaffolds have been pulled\n", args[0], len(index.Scaffolds))
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached scaffold repositories that haven't been used recently",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cache, err := repoCache()
+		if err != nil {
+			return err
+		}
+		pruned, err := cache.Prune(time.Now().Add(-pruneOlderThan))
+		for _, entry := range pruned {
+			fmt.Printf("Removed %s\n", internal.RedactUrl(entry.Url))
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pruned %d repositories\n", len(pruned))
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached manifests and scaffold repositories",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cacheDir, err := internal.DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		if err = os.RemoveAll(cacheDir); err != nil {
+			return err
+		}
+		fmt.Printf("Cleared %s\n", cacheDir)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePullCmd)
+	cachePullCmd.Flags().BoolVar(&pullAll, "all", false, "Pull every scaffold in the current manifests")
+	cacheCmd.AddCommand(cacheExportCmd)
+	cacheCmd.AddCommand(cacheImportCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cachePruneCmd.Flags().DurationVar(&pruneOlderThan, "older-than", 30*24*time.Hour, "Remove repositories that haven't been used for this long")
+	cacheCmd.AddCommand(cacheClearCmd)
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"bomoko/lagoon-init/internal"
+	"fmt"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var catalogPublicKeys []string
+var catalogToken string
+var catalogHeaders []string
+var catalogNetrc bool
+var catalogGit internal.GitCredentials
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Manage the catalogs (manifests) scaffolds are loaded from",
+	Long:  `Manage the named catalogs (manifest files or urls) that scaffolds are loaded from`,
+}
+
+var catalogAddCmd = &cobra.Command{
+	Use:     "add <name> <manifest path or url>",
+	Short:   "Register a new catalog",
+	Example: "lagoon-scaffold catalog add internal https://example.com/scaffolds.yml",
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		catalog := internal.Catalog{
+			Name:       args[0],
+			Location:   args[1],
+			PublicKeys: catalogPublicKeys,
+			Credentials: internal.ManifestCredentials{
+				Token: catalogToken,
+				Netrc: catalogNetrc,
+			},
+			Git: catalogGit,
+		}
+		for _, header := range catalogHeaders {
+			name, value, found := strings.Cut(header, ":")
+			if !found {
+				return fmt.Errorf("invalid header `%v` - headers should look like `Name: value`", header)
+			}
+			if catalog.Credentials.Headers == nil {
+				catalog.Credentials.Headers = map[string]string{}
+			}
+			catalog.Credentials.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		if err = config.AddCatalog(catalog); err != nil {
+			return err
+		}
+		if err = config.Save(path); err != nil {
+			return err
+		}
+		fmt.Printf("Added catalog `%v`\n", args[0])
+		return nil
+	},
+}
+
+var catalogRemoveCmd = &cobra.Command{
+	Use:   "remove <name>",
+	Short: "Remove a registered catalog",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, path, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if err = config.RemoveCatalog(args[0]); err != nil {
+			return err
+		}
+		if err = config.Save(path); err != nil {
+			return err
+		}
+		fmt.Printf("Removed catalog `%v`\n", args[0])
+		return nil
+	},
+}
+
+var catalogListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered catalogs, lowest precedence first",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, _, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		defaultSource := internal.DefaultManifestSource()
+		fmt.Printf("%s\t%s (built in)\n", defaultSource.Name, defaultSource.Location)
+		for _, catalog := range config.Catalogs {
+			signed := ""
+			if len(catalog.PublicKeys) > 0 {
+				signed = " (signed)"
+			}
+			fmt.Printf("%s\t%s%s\n", catalog.Name, internal.RedactUrl(catalog.Location), signed)
+		}
+		return nil
+	},
+}
+
+var catalogRefreshCmd = &cobra.Command{
+	Use:   "refresh [name...]",
+	Short: "Revalidate cached catalogs and report the scaffolds they provide",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, _, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		options, err := manifestOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		options.Refresh = true
+		sources := append([]internal.ManifestSource{internal.DefaultManifestSource()}, config.ManifestSources()...)
+		if len(args) > 0 {
+			sources = sources[:0]
+			for _, name := range args {
+				catalog, ok := config.GetCatalog(name)
+				if !ok {
+					return fmt.Errorf("catalog `%v` does not exist", name)
+				}
+				sources = append(sources, catalog.ManifestSource())
+			}
+		}
+		failed := false
+		for _, source := range sources {
+			scaffolds, err := internal.GetScaffolds([]internal.ManifestSource{source}, options)
+			if err != nil {
+				fmt.Println(err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s: %d scaffolds\n", source.Name, len(scaffolds))
+		}
+		if failed {
+			return fmt.Errorf("one or more catalogs could not be refreshed")
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogAddCmd)
+	catalogAddCmd.Flags().StringVar(&catalogToken, "token", "", "A bearer token sent when fetching the catalog - use ${VAR} to read it from the environment at fetch time")
+	catalogAddCmd.Flags().StringArrayVar(&catalogHeaders, "header", []string{}, "A `Name: value` header sent when fetching the catalog - may be repeated, ${VAR} references are expanded")
+	catalogAddCmd.Flags().BoolVar(&catalogNetrc, "netrc", false, "Use credentials from ~/.netrc when fetching the catalog")
+	catalogAddCmd.Flags().StringArrayVar(&catalogPublicKeys, "public-key", []string{}, "A minisign public key trusted to sign the catalog's manifest - may be repeated. If given, the manifest must be signed")
+	catalogAddCmd.Flags().StringVar(&catalogGit.SSHKey, "ssh-key", "", "Private key used to clone the catalog's scaffolds over ssh")
+	catalogAddCmd.Flags().StringVar(&catalogGit.SSHPassphrase, "ssh-passphrase", "", "Passphrase for --ssh-key - use ${VAR} to read it from the environment")
+	catalogAddCmd.Flags().StringVar(&catalogGit.Username, "git-username", "", "Username used to clone the catalog's scaffolds over https")
+	catalogAddCmd.Flags().StringVar(&catalogGit.Password, "git-password", "", "Password used to clone the catalog's scaffolds over https - use ${VAR} to read it from the environment")
+	catalogAddCmd.Flags().StringVar(&catalogGit.Token, "git-token", "", "Token used to clone the catalog's scaffolds over https - use ${VAR} to read it from the environment")
+	catalogCmd.AddCommand(catalogRemoveCmd)
+	catalogCmd.AddCommand(catalogListCmd)
+	catalogCmd.AddCommand(catalogRefreshCmd)
+}
@@ -20,10 +20,16 @@ var flowCmd = &cobra.Command{
 		} else {
 			flowData, err := ioutil.ReadFile(flowFile)
 			if err != nil {
-				return fmt.Errorf("Error reading file: ", err)
+				return fmt.Errorf("Error reading file: %v", err)
+			}
+			data, err := internal.UnmarshallSurveyQuestions(flowData)
+			if err != nil {
+				return fmt.Errorf("Error parsing flow: %v", err)
+			}
+			output, err := internal.FlowToGraph(0, data)
+			if err != nil {
+				return err
 			}
-			data, _ := internal.UnmarshallSurveyQuestions(flowData)
-			output, _ := internal.FlowToGraph(0, data)
 			fmt.Printf("\n%s:\n\n", flowFile)
 			fmt.Println(output)
 		}
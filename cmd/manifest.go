@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"bomoko/lagoon-init/internal"
+	"fmt"
+	"github.com/spf13/cobra"
+)
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Utilities for scaffold manifest authors",
+	Long:  `Utilities for scaffold manifest authors`,
+}
+
+var manifestValidateCmd = &cobra.Command{
+	Use:     "validate <manifest>",
+	Short:   "Check a manifest for errors",
+	Long:    "Checks a manifest (a file, url, git+ssh:// reference or - for stdin) for unknown fields, duplicate names, missing sources and refs, and invalid urls",
+	Example: "lagoon-scaffold manifest validate ./scaffolds.yml",
+	Args:    cobra.ExactArgs(1),
+	// problems with the manifest aren't usage errors
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		options, err := manifestOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		data, err := internal.ReadManifest(args[0], options)
+		if err != nil {
+			return err
+		}
+		problems := internal.ValidateManifest(data)
+		for _, problem := range problems {
+			fmt.Printf("%s: %s\n", args[0], problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problem(s) in %v", len(problems), args[0])
+		}
+		fmt.Printf("%s is valid\n", args[0])
+		return nil
+	},
+}
+
+var verifyConcurrency int
+
+var manifestVerifyCmd = &cobra.Command{
+	Use:   "verify <manifest> [scaffold...]",
+	Short: "Fetch and run every scaffold in a manifest with default values",
+	Long: `Fetches each scaffold in a manifest (or just those named), checks its .lagoon/flow.yml parses,
+runs the flow non-interactively with default values, and renders every template - reporting a pass/fail matrix`,
+	Example:      "lagoon-scaffold manifest verify ./scaffolds.yml --concurrency=8",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		options, err := manifestOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		scaffolds, err := internal.GetScaffolds([]internal.ManifestSource{internal.NewManifestSource(args[0])}, options)
+		if err != nil {
+			return err
+		}
+
+		var toVerify []internal.ScaffoldRepo
+		if len(args) > 1 {
+			for _, name := range args[1:] {
+				repo, ok := internal.FindScaffold(scaffolds, name)
+				if !ok {
+					return fmt.Errorf("Scaffold `%v` does not exist in %v", name, args[0])
+				}
+				toVerify = append(toVerify, repo)
+			}
+		} else {
+			for _, name := range getScaffoldsKeys(scaffolds) {
+				toVerify = append(toVerify, scaffolds[name])
+			}
+		}
+
+		sourceOptions, err := sourceOptions(cmd.Context())
+		if err != nil {
+			return err
+		}
+		// progress from concurrent fetches would just interleave with each other
+		sourceOptions.Progress = nil
+		results := internal.VerifyScaffolds(toVerify, sourceOptions, verifyConcurrency)
+		fmt.Println(internal.FormatVerifyResults(results))
+
+		failed := 0
+		for _, result := range results {
+			if !result.Passed() {
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d scaffolds failed verification", failed, len(results))
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(manifestCmd)
+	manifestCmd.AddCommand(manifestValidateCmd)
+	manifestCmd.AddCommand(manifestVerifyCmd)
+	manifestVerifyCmd.Flags().IntVar(&verifyConcurrency, "concurrency", 4, "How many scaffolds to verify at once")
+}
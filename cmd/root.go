@@ -2,34 +2,221 @@ package cmd
 
 import (
 	"bomoko/lagoon-init/internal"
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
-	"github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/plumbing"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	cp "github.com/otiai10/copy"
 	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v2"
-	"io/fs"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
-	"path"
-	"path/filepath"
 	"sort"
+	"strings"
+	"time"
 )
 
 var targetDirectory string
-var localManifest string
+var localManifests []string
+var noDefaultManifest bool
+var configFile string
+var refreshManifests bool
+var offline bool
+var manifestTTL time.Duration
+var strictManifest bool
+var requestTimeout time.Duration
 var scaffold string
 var noInteraction bool
 var inputFile string
 var privateKeyFile string
+var gitRef string
+var caFile string
+var knownHostsFile string
+var httpClient *http.Client
+var explainRewrites bool
+var rewriter *internal.URLRewriter
+
+func loadConfig() (*internal.Config, string, error) {
+	path := configFile
+	if path == "" {
+		var err error
+		path, err = internal.DefaultConfigPath()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	config, err := internal.LoadConfig(path)
+	return config, path, err
+}
+
+// manifestEnvVar can provide a comma separated list of manifests in place of --manifest
+const manifestEnvVar = "LAGOON_SCAFFOLD_MANIFEST"
+
+// manifestSources returns the manifests to load scaffolds from, lowest precedence first -
+// the default Lagoon manifest, then any registered catalogs, then any passed with --manifest (or LAGOON_SCAFFOLD_MANIFEST)
+func manifestSources() ([]internal.ManifestSource, error) {
+	config, _, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	var sources []internal.ManifestSource
+	if !noDefaultManifest {
+		sources = append(sources, internal.DefaultManifestSource())
+	}
+	sources = append(sources, config.ManifestSources()...)
+	manifests := localManifests
+	if len(manifests) == 0 && os.Getenv(manifestEnvVar) != "" {
+		manifests = strings.Split(os.Getenv(manifestEnvVar), ",")
+	}
+	for _, manifest := range manifests {
+		sources = append(sources, internal.NewManifestSource(manifest))
+	}
+	return sources, nil
+}
+
+// setupNetwork builds the client used for manifests, archives and git over http(s), honouring
+// --ca-file, the config's ca_file and proxy settings, and the usual proxy environment variables,
+// along with the config's url rewrite rules
+func setupNetwork(cmd *cobra.Command, args []string) error {
+	config, _, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	options := internal.HTTPClientOptions{CAFile: config.CAFile, Proxy: config.Proxy}
+	if caFile != "" {
+		options.CAFile = caFile
+	}
+	httpClient, err = internal.NewHTTPClient(options)
+	if err != nil {
+		return err
+	}
+	internal.InstallGitHTTPClient(httpClient)
+
+	rewriter = &internal.URLRewriter{Rules: config.Rewrites}
+	if explainRewrites {
+		rewriter.Explain = os.Stderr
+	}
+	return nil
+}
 
-func getScaffoldsKeys() []string {
-	scaffolds, _ := internal.GetScaffolds(localManifest)
+// gitAuthenticator decides how to authenticate to git repositories for both scaffolds and manifests -
+// with --privatekey, or ssh-agent, for ssh, and tokens, passwords or git's credential helpers for https
+func gitAuthenticator() (*internal.GitAuthenticator, error) {
+	config, _, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	var knownHosts []string
+	if knownHostsFile != "" {
+		knownHosts = []string{knownHostsFile}
+	} else if config.KnownHosts != "" {
+		knownHosts = []string{config.KnownHosts}
+	}
+	return &internal.GitAuthenticator{
+		Credentials:       internal.GitCredentials{SSHKey: privateKeyFile},
+		Catalogs:          config.GitCredentials(),
+		CredentialHelpers: true,
+		KnownHosts:        knownHosts,
+		TrustHost:         trustHost,
+		Passphrase: func(keyFile string) (string, error) {
+			if noInteraction {
+				return "", fmt.Errorf("ssh key %v is encrypted - set %v to its passphrase", keyFile, internal.SSHPassphraseEnvVar)
+			}
+			var passphrase string
+			err := survey.AskOne(&survey.Password{Message: fmt.Sprintf("Passphrase for %v", keyFile)}, &passphrase)
+			return passphrase, err
+		},
+	}, nil
+}
+
+// trustHost asks the user whether to trust an ssh host we've never seen - never in non-interactive runs
+func trustHost(hostname string, key ssh.PublicKey) (bool, error) {
+	if noInteraction {
+		return false, fmt.Errorf("%v is not a known host - add its %v key (fingerprint %v) to known_hosts, or pin it with host_key in the manifest",
+			hostname, key.Type(), ssh.FingerprintSHA256(key))
+	}
+	trust := false
+	err := survey.AskOne(&survey.Confirm{
+		Message: fmt.Sprintf("The authenticity of host %v can't be established.\nIts %v key fingerprint is %v.\n"+
+			"Only continue if you've checked this fingerprint with the host's owner. Trust this host and add it to known_hosts?",
+			hostname, key.Type(), ssh.FingerprintSHA256(key)),
+		Default: false,
+	}, &trust)
+	return trust, err
+}
+
+func manifestOptions(ctx context.Context) (internal.ManifestOptions, error) {
+	authenticator, err := gitAuthenticator()
+	if err != nil {
+		return internal.ManifestOptions{}, err
+	}
+	options := internal.ManifestOptions{
+		Refresh:          refreshManifests,
+		Offline:          offline,
+		Strict:           strictManifest,
+		GitAuthenticator: authenticator,
+		Context:          ctx,
+		Timeout:          requestTimeout,
+		HTTPClient:       httpClient,
+		Rewriter:         rewriter,
+		Warnings:         os.Stderr,
+	}
+	config, _, err := loadConfig()
+	if err != nil {
+		return options, err
+	}
+	ttl := manifestTTL
+	if ttl == 0 {
+		if ttl, err = config.GetManifestTTL(); err != nil {
+			return options, err
+		}
+	}
+	cacheDir, err := internal.DefaultCacheDir()
+	if err != nil {
+		return options, err
+	}
+	options.Cache = internal.NewManifestCache(cacheDir, ttl)
+	return options, nil
+}
+
+// sourceOptions returns the options used to fetch scaffolds, cloning git repositories via the mirror cache
+func sourceOptions(ctx context.Context) (internal.SourceOptions, error) {
+	cacheDir, err := internal.DefaultCacheDir()
+	if err != nil {
+		return internal.SourceOptions{}, err
+	}
+	authenticator, err := gitAuthenticator()
+	if err != nil {
+		return internal.SourceOptions{}, err
+	}
+	return internal.SourceOptions{
+		Ref:           gitRef,
+		Authenticator: authenticator,
+		Progress:      os.Stdout,
+		HTTPClient:    httpClient,
+		Rewriter:      rewriter,
+		Cache:         internal.NewRepoCache(cacheDir),
+		Offline:       offline,
+		Context:       ctx,
+	}, nil
+}
+
+func getAllScaffolds(ctx context.Context) (map[string]internal.ScaffoldRepo, error) {
+	sources, err := manifestSources()
+	if err != nil {
+		return nil, err
+	}
+	options, err := manifestOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return internal.GetScaffolds(sources, options)
+}
+
+func getScaffoldsKeys(scaffolds map[string]internal.ScaffoldRepo) []string {
 	var ret []string
 	for k := range scaffolds {
 		ret = append(ret, k)
@@ -38,16 +225,12 @@ func getScaffoldsKeys() []string {
 	return ret
 }
 
-func selectScaffold(scaffold *string) error {
-	scaffolds, err := internal.GetScaffolds(localManifest)
-	if err != nil {
-		return err
-	}
+func selectScaffold(scaffolds map[string]internal.ScaffoldRepo, scaffold *string) error {
 	prompt := survey.Select{
 		Message: "Select a scaffold to run",
-		Options: getScaffoldsKeys(),
+		Options: getScaffoldsKeys(scaffolds),
 		Description: func(value string, index int) string {
-			return scaffolds[value].ShortDescription
+			return fmt.Sprintf("[%s] %s", scaffolds[value].Source, scaffolds[value].ShortDescription)
 		},
 	}
 
@@ -56,12 +239,13 @@ func selectScaffold(scaffold *string) error {
 }
 
 var RootCmd = &cobra.Command{
-	Use:   "scaffold",
-	Short: "Lagoon scaffold will pull a new site and fill in the details",
-	Long:  `Lagoon scaffold will pull a new site and fill in the details`,
+	Use:               "scaffold",
+	Short:             "Lagoon scaffold will pull a new site and fill in the details",
+	Long:              `Lagoon scaffold will pull a new site and fill in the details`,
+	PersistentPreRunE: setupNetwork,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		scaffolds, err := internal.GetScaffolds(localManifest)
+		scaffolds, err := getAllScaffolds(cmd.Context())
 
 		if err != nil {
 			fmt.Println(err)
@@ -73,10 +257,10 @@ var RootCmd = &cobra.Command{
 		}
 
 		if scaffold == "" {
-			selectScaffold(&scaffold)
+			selectScaffold(scaffolds, &scaffold)
 		}
 
-		repo, ok := scaffolds[scaffold]
+		repo, ok := internal.FindScaffold(scaffolds, scaffold)
 		// If the key exists
 		if !ok {
 			return errors.New(fmt.Sprintf("Scaffold `%v` does not exist", scaffold))
@@ -92,38 +276,16 @@ var RootCmd = &cobra.Command{
 
 		fmt.Println(tDir)
 
-		// Here we deal with sshkeys, if one is passed to us
-
-		cloneOptions := &git.CloneOptions{
-			URL: repo.GitRepo,
-			//Depth:         1,
-			ReferenceName: plumbing.NewBranchReferenceName(repo.Branch),
-			SingleBranch:  true,
-			Progress:      os.Stdout,
-		}
-
-		if privateKeyFile != "" {
-			_, err := os.Stat(privateKeyFile)
-			if err != nil {
-				log.Fatalf("read file %s failed %s\n", privateKeyFile, err.Error())
-			}
-
-			publicKeys, err := ssh.NewPublicKeysFromFile("git", privateKeyFile, "")
-			if err != nil {
-				log.Fatalf("generate publickeys failed: %s\n", err.Error())
-			}
-
-			cloneOptions.Auth = publicKeys
+		options, err := sourceOptions(cmd.Context())
+		if err != nil {
+			return err
 		}
-
-		_, err = git.PlainClone(tDir, false, cloneOptions)
-
+		source, err := internal.NewSource(repo, options)
 		if err != nil {
 			return err
 		}
 
-		err = cleanRemoveDir(tDir + "/.git")
-		if err != nil {
+		if err = source.Fetch(tDir); err != nil {
 			return err
 		}
 
@@ -141,7 +303,7 @@ var RootCmd = &cobra.Command{
 		var values interface{}
 
 		if inputFile == "" {
-			values, err = internal.RunFromSurveyQuestions(questions, !noInteraction)
+			values, err = internal.RunFromSurveyQuestionsWithData(questions, !noInteraction, internal.NewFlowData(targetDirectory))
 			if err != nil {
 				log.Fatalf("Error running survey: %v", err)
 			}
@@ -154,9 +316,12 @@ var RootCmd = &cobra.Command{
 			if err != nil {
 				log.Fatalf("Error parsing YAML file: %v", err)
 			}
+			if err = internal.ValidateValues(questions, values, internal.NewFlowData(targetDirectory)); err != nil {
+				return fmt.Errorf("invalid values in %v:\n%w", inputFile, err)
+			}
 		}
 
-		if err = processTemplates(values, tDir); err != nil {
+		if err = internal.ProcessTemplates(values, tDir); err != nil {
 			return err
 		}
 
@@ -181,34 +346,6 @@ var RootCmd = &cobra.Command{
 	},
 }
 
-func processTemplates(values interface{}, tempDir string) error {
-	return filepath.WalkDir(tempDir, func(p string, d fs.DirEntry, err error) error {
-		if !d.IsDir() && filepath.Ext(p) == ".lgtmpl" {
-			templ, err := internal.GetTemplate(filepath.Base(p)).ParseFiles(p)
-			if err != nil {
-				return err
-			}
-			var buf bytes.Buffer
-			err = templ.Execute(&buf, values)
-			if err != nil {
-				return err
-			}
-
-			outputName := p[:len(p)-len(path.Ext(p))]
-			err = os.WriteFile(outputName, buf.Bytes(), 0644)
-			if err != nil {
-				return err
-			}
-			//remove the file from the temp dir
-			err = os.Remove(p)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
-	})
-}
-
 func readValuesFile(tempDir string, noInteraction bool) (interface{}, error) {
 	//we should find a values file in the root
 	valfilename := tempDir + "/.lagoon/values.yml"
@@ -271,12 +408,16 @@ var listCmd = &cobra.Command{
 	Short:   "List currently supported templates",
 	Long:    "Lists all currently supported Lagoon scaffolds",
 	Example: "lagoon-init-prot list",
-	Run: func(cmd *cobra.Command, args []string) {
-		scaffolds, _ := internal.GetScaffolds(localManifest)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scaffolds, err := getAllScaffolds(cmd.Context())
+		if err != nil {
+			return err
+		}
 		fmt.Println("We currently support the following:")
-		for pagage := range scaffolds {
-			fmt.Println(pagage)
+		for _, name := range getScaffoldsKeys(scaffolds) {
+			fmt.Printf("%s (catalog: %s)\n", name, scaffolds[name].Source)
 		}
+		return nil
 	},
 }
 
@@ -285,10 +426,21 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&scaffold, "scaffold", "", "Which scaffold to pull into directory")
 	RootCmd.Flags().BoolVar(&noInteraction, "no-interaction", false, "Don't interactively fill in any values for the scaffold - use defaults")
 	RootCmd.Flags().StringVar(&targetDirectory, "targetdir", "./", "Directory to check out project into - defaults to current directory")
-	RootCmd.Flags().StringVar(&localManifest, "manifest", "", "Custom local manifest file for scaffold list - defaults to an empty string")
+	RootCmd.PersistentFlags().StringArrayVar(&localManifests, "manifest", []string{}, "Additional manifest for the scaffold list - a file, http(s) url, git+ssh://repo#ref:path/to/scaffolds.yml or - for stdin. May be repeated, later manifests override earlier ones. Defaults to $"+manifestEnvVar)
+	RootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Path to the lagoon-scaffold config file - defaults to the user's config directory")
+	RootCmd.PersistentFlags().BoolVar(&noDefaultManifest, "no-default-manifest", false, "Don't include the default Lagoon scaffold manifest")
+	RootCmd.PersistentFlags().BoolVar(&refreshManifests, "refresh", false, "Revalidate cached manifests with their servers, regardless of the cache TTL")
+	RootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Only use cached data, never access the network")
+	RootCmd.PersistentFlags().BoolVar(&strictManifest, "strict-manifest", false, "Fail if a manifest can't be fetched or parsed, rather than falling back to a cached or embedded copy")
+	RootCmd.PersistentFlags().DurationVar(&requestTimeout, "timeout", internal.DefaultManifestTimeout, "How long to wait for each manifest request before giving up")
+	RootCmd.PersistentFlags().DurationVar(&manifestTTL, "manifest-ttl", 0, "How long fetched manifests are cached before being revalidated - defaults to the config's manifest_ttl, or 1h")
 	RootCmd.Flags().StringVar(&inputFile, "values", "", "A Yaml file that provides defaults/answers for a scaffold - can be used in automation")
+	RootCmd.Flags().StringVar(&gitRef, "ref", "", "Tag, branch, commit or semver constraint to check out, overriding the scaffold's manifest entry")
+	RootCmd.PersistentFlags().StringVar(&caFile, "ca-file", "", "PEM bundle of extra certificate authorities to trust for https requests - defaults to the config's ca_file")
+	RootCmd.PersistentFlags().BoolVar(&explainRewrites, "explain", false, "Show how each manifest, git and archive url is rewritten by the config's rewrite rules")
+	RootCmd.PersistentFlags().StringVar(&knownHostsFile, "known-hosts", "", "known_hosts file used to verify ssh hosts - defaults to the config's known_hosts, or ~/.ssh/known_hosts")
 	//privateKeyFile
-	RootCmd.Flags().StringVar(&privateKeyFile, "privatekey", "", "If private repository is used, this points to the private key used to access it")
+	RootCmd.PersistentFlags().StringVar(&privateKeyFile, "privatekey", "", "Private key used to access ssh git repositories - defaults to ssh-agent. Encrypted keys' passphrases are read from $"+internal.SSHPassphraseEnvVar+" or prompted for")
 }
 
 func Execute() {
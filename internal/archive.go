@@ -0,0 +1,304 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	cp "github.com/otiai10/copy"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archive.go fetches scaffolds distributed as .tar.gz or .zip archives, e.g. from an artifact store.
+
+type archiveSource struct {
+	location string
+	sha256   string
+	options  SourceOptions
+}
+
+func newArchiveSource(repo ScaffoldRepo, options SourceOptions) (*archiveSource, error) {
+	if options.Ref != "" {
+		return nil, errors.New("a ref cannot be used with an archive scaffold")
+	}
+	if repo.SHA256 == "" {
+		return nil, fmt.Errorf("scaffold `%v` must specify the sha256 of its archive", repo.Name)
+	}
+	if archiveFormat(repo.Archive) == "" {
+		return nil, fmt.Errorf("unsupported archive %v - only .tar.gz, .tgz and .zip are supported", repo.Archive)
+	}
+	return &archiveSource{location: repo.Archive, sha256: strings.ToLower(repo.SHA256), options: options}, nil
+}
+
+func archiveFormat(location string) string {
+	location = strings.ToLower(location)
+	if i := strings.IndexAny(location, "?#"); i != -1 && isRemoteLocation(location) {
+		location = location[:i]
+	}
+	switch {
+	case strings.HasSuffix(location, ".tar.gz"), strings.HasSuffix(location, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(location, ".zip"):
+		return "zip"
+	}
+	return ""
+}
+
+func (s *archiveSource) String() string {
+	return s.location
+}
+
+func (s *archiveSource) read() ([]byte, error) {
+	if !isRemoteLocation(s.location) {
+		return os.ReadFile(strings.TrimPrefix(s.location, "file://"))
+	}
+	if s.options.Cache != nil {
+		if data, err := s.options.Cache.GetArchive(s.sha256); err == nil {
+			return data, nil
+		}
+	}
+	if s.options.Offline {
+		return nil, fmt.Errorf("%v is not cached, and cannot be fetched while offline", RedactUrl(s.location))
+	}
+	client := s.options.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(s.options.fetchContext(), http.MethodGet, s.location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching %v: %v", s.location, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *archiveSource) Fetch(dest string) error {
+	if s.options.Progress != nil {
+		fmt.Fprintf(s.options.Progress, "Fetching archive %v\n", s.location)
+	}
+	data, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != s.sha256 {
+		return fmt.Errorf("checksum mismatch for %v: expected sha256 %v, got %v", s.location, s.sha256, actual)
+	}
+	if s.options.Cache != nil && isRemoteLocation(s.location) {
+		if err = s.options.Cache.PutArchive(s.sha256, data); err != nil {
+			return err
+		}
+	}
+
+	staging, err := os.MkdirTemp("", "lagoon-scaffold-archive")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	switch archiveFormat(s.location) {
+	case "zip":
+		err = extractZip(data, staging)
+	default:
+		err = extractTarGz(data, staging)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to extract %v: %w", s.location, err)
+	}
+
+	return cp.Copy(archiveRoot(staging), dest)
+}
+
+// archiveRoot returns the single top level directory of an extracted archive, if there is one,
+// since archives (e.g. those generated by github) are commonly wrapped in one
+func archiveRoot(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() || entries[0].Name() == ".lagoon" {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// safeArchivePath returns where an archive entry should be written, refusing entries that would escape dest
+func safeArchivePath(dest, name string) (string, error) {
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") {
+		return "", fmt.Errorf("archive entry %v has an absolute path", name)
+	}
+	target := filepath.Join(dest, name)
+	if target != dest && !strings.HasPrefix(target, dest+string(os.PathSeparator)) {
+		return "", fmt.Errorf("archive entry %v escapes the extraction directory", name)
+	}
+	return target, nil
+}
+
+// checkLinkTarget refuses links that point outside of dest
+func checkLinkTarget(dest, path, linkTarget string) error {
+	if filepath.IsAbs(linkTarget) {
+		return fmt.Errorf("archive entry %v links to absolute path %v", path, linkTarget)
+	}
+	resolved := filepath.Join(filepath.Dir(path), linkTarget)
+	if resolved != dest && !strings.HasPrefix(resolved, dest+string(os.PathSeparator)) {
+		return fmt.Errorf("archive entry %v links outside of the extraction directory", path)
+	}
+	return nil
+}
+
+// checkSymlinkedParents refuses entries written through a symlink extracted earlier that leads outside of dest -
+// e.g. with l2 -> . and l1 -> l2/.., each link looks safe on its own, but l1/file would be written beside dest.
+// Entries also can't replace a symlink, as writing to it would follow it.
+func checkSymlinkedParents(dest, target string) error {
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	existing := filepath.Dir(target)
+	for existing != dest {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return fmt.Errorf("archive entry %v is written through a broken link", target)
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(os.PathSeparator)) {
+		return fmt.Errorf("archive entry %v is written through a link outside of the extraction directory", target)
+	}
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("archive entry %v replaces a link", target)
+	}
+	return nil
+}
+
+// checkLinkResolves refuses a freshly extracted link that, once any links it goes through are followed, points outside of dest
+func checkLinkResolves(dest, link string) error {
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		// links to things that don't exist (yet) are checked when something is written through them
+		return nil
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(os.PathSeparator)) {
+		return fmt.Errorf("archive entry %v links outside of the extraction directory", link)
+	}
+	return nil
+}
+
+func writeArchiveFile(target string, mode os.FileMode, contents io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, contents)
+	return err
+}
+
+func extractTarGz(data []byte, dest string) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := safeArchivePath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		if err = checkSymlinkedParents(dest, target); err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err = writeArchiveFile(target, header.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err = checkLinkTarget(dest, target, header.Linkname); err != nil {
+				return err
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err = os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+			if err = checkLinkResolves(dest, target); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+		default:
+			return fmt.Errorf("archive entry %v has unsupported type %v", header.Name, string(header.Typeflag))
+		}
+	}
+}
+
+func extractZip(data []byte, dest string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+	for _, file := range zr.File {
+		target, err := safeArchivePath(dest, file.Name)
+		if err != nil {
+			return err
+		}
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			return fmt.Errorf("archive entry %v is a symlink, which isn't supported in zip archives", file.Name)
+		default:
+			rc, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = writeArchiveFile(target, mode, rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testArchiveEntry struct {
+	name     string
+	body     string
+	linkname string
+}
+
+func buildTarGz(t *testing.T, entries []testArchiveEntry) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: tar.TypeReg}
+		if entry.linkname != "" {
+			header = &tar.Header{Name: entry.name, Linkname: entry.linkname, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func buildZip(t *testing.T, entries []testArchiveEntry) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(entry.body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestArchiveSourceFetch(t *testing.T) {
+	scaffoldEntries := []testArchiveEntry{
+		{name: "scaffold-main/.lagoon/flow.yml", body: "questions: []"},
+		{name: "scaffold-main/README.md", body: "readme"},
+		{name: "scaffold-main/docs/README.md", linkname: "../README.md"},
+	}
+	tarGz := buildTarGz(t, scaffoldEntries)
+	zipped := buildZip(t, scaffoldEntries[:2])
+
+	dir := t.TempDir()
+	tarPath := filepath.Join(dir, "scaffold.tar.gz")
+	os.WriteFile(tarPath, tarGz, 0644)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipped)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		repo    ScaffoldRepo
+		wantErr bool
+	}{
+		{"local tar.gz", ScaffoldRepo{Archive: tarPath, SHA256: checksum(tarGz)}, false},
+		{"remote zip", ScaffoldRepo{Archive: server.URL + "/scaffold.zip", SHA256: checksum(zipped)}, false},
+		{"checksum mismatch", ScaffoldRepo{Archive: tarPath, SHA256: checksum(zipped)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(tt.repo, SourceOptions{})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			dest := t.TempDir()
+			err = source.Fetch(dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, err = os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+				t.Errorf("Fetch() should strip the archive's top level directory: %v", err)
+			}
+		})
+	}
+}
+
+func TestArchiveSourceCacheIsPrivate(t *testing.T) {
+	zipped := buildZip(t, []testArchiveEntry{{name: "scaffold-main/.lagoon/flow.yml", body: "questions: []"}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipped)
+	}))
+	defer server.Close()
+
+	cache := NewRepoCache(t.TempDir())
+	source, err := NewSource(ScaffoldRepo{Archive: server.URL + "/scaffold.zip", SHA256: checksum(zipped)}, SourceOptions{Cache: cache})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	if err = source.Fetch(t.TempDir()); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	for path, want := range map[string]os.FileMode{cache.ArchiveDir: 0700, cache.archivePath(checksum(zipped)): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%v has permissions %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestArchiveSourceFetchCancelled(t *testing.T) {
+	// a download that never finishes
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-stalled:
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	source, err := NewSource(ScaffoldRepo{Archive: server.URL + "/scaffold.zip", SHA256: "abc"}, SourceOptions{Context: ctx})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- source.Fetch(t.TempDir()) }()
+	select {
+	case err = <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Fetch() error = %v, want the context's", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Fetch() wasn't cancelled with its context")
+	}
+}
+
+func TestArchiveSourceRejectsUnsafeArchives(t *testing.T) {
+	if _, err := NewSource(ScaffoldRepo{Archive: "scaffold.tar.gz"}, SourceOptions{}); err == nil {
+		t.Errorf("NewSource() without a sha256 expected an error")
+	}
+	if _, err := NewSource(ScaffoldRepo{Archive: "scaffold.rar", SHA256: "abc"}, SourceOptions{}); err == nil {
+		t.Errorf("NewSource() with an unsupported format expected an error")
+	}
+
+	tests := map[string][]byte{
+		"tar traversal":     buildTarGz(t, []testArchiveEntry{{name: "../evil", body: "evil"}}),
+		"tar absolute path": buildTarGz(t, []testArchiveEntry{{name: "/tmp/evil", body: "evil"}}),
+		"tar symlink out":   buildTarGz(t, []testArchiveEntry{{name: "link", linkname: "../../etc/passwd"}}),
+		"tar chained symlinks": buildTarGz(t, []testArchiveEntry{
+			{name: "l2", linkname: "."},
+			{name: "l1", linkname: "l2/.."},
+			{name: "l1/escaped.txt", body: "escaped"},
+		}),
+		"tar write through symlink": buildTarGz(t, []testArchiveEntry{
+			{name: "l2", linkname: "."},
+			{name: "l1", linkname: "l2/../escaped.txt"},
+			{name: "l1", body: "escaped"},
+		}),
+		"zip traversal": buildZip(t, []testArchiveEntry{{name: "a/../../evil", body: "evil"}}),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			ext := ".tar.gz"
+			if name == "zip traversal" {
+				ext = ".zip"
+			}
+			// archives are extracted into a staging directory under TMPDIR, so that's where anything escaping lands
+			tmp := t.TempDir()
+			t.Setenv("TMPDIR", tmp)
+			path := filepath.Join(t.TempDir(), "scaffold"+ext)
+			os.WriteFile(path, data, 0644)
+			source, err := NewSource(ScaffoldRepo{Archive: path, SHA256: checksum(data)}, SourceOptions{})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			if err = source.Fetch(t.TempDir()); err == nil {
+				t.Errorf("Fetch() expected an error for an unsafe archive")
+			}
+			if _, err = os.Stat(filepath.Join(tmp, "escaped.txt")); err == nil {
+				t.Errorf("Fetch() wrote a file outside of the extraction directory")
+			}
+		})
+	}
+}
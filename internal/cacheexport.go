@@ -0,0 +1,114 @@
+package internal
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	cp "github.com/otiai10/copy"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// cacheexport.go moves a whole cache - manifests, mirrors, archives and index - between machines as a single .tar.gz
+
+// ExportCache writes the contents of cacheDir to w as a gzipped tarball
+func ExportCache(cacheDir string, w io.Writer) error {
+	if _, err := os.Stat(cacheDir); err != nil {
+		return fmt.Errorf("nothing has been cached: %w", err)
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	err := filepath.WalkDir(cacheDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(cacheDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ImportCache adds a cache exported with ExportCache to cacheDir, returning the merged index.
+// Imported manifests, mirrors and archives replace any we already have.
+func ImportCache(cacheDir string, r io.Reader) (*CacheIndex, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	staging, err := os.MkdirTemp("", "lagoon-scaffold-import")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err = extractTarGz(data, staging); err != nil {
+		return nil, fmt.Errorf("unable to extract cache: %w", err)
+	}
+	imported, err := LoadCacheIndex(CacheIndexPath(staging))
+	if err != nil {
+		return nil, err
+	}
+
+	// mirrors' pack files can't be merged file by file, so imported mirrors replace ours wholesale
+	mirrors, err := NewRepoCache(staging).List()
+	if err != nil {
+		return nil, err
+	}
+	local := NewRepoCache(cacheDir)
+	for _, mirror := range mirrors {
+		if err = local.Remove(mirror.Url); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = os.Remove(CacheIndexPath(staging)); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err = cp.Copy(staging, cacheDir); err != nil {
+		return nil, err
+	}
+
+	index, err := LoadCacheIndex(CacheIndexPath(cacheDir))
+	if err != nil {
+		return nil, err
+	}
+	index.Merge(imported)
+	return index, index.Save(CacheIndexPath(cacheDir))
+}
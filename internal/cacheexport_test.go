@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportImportCache(t *testing.T) {
+	gitDir, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	repo := ScaffoldRepo{Name: "exported", Source: "test", GitRepo: "file://" + gitDir}
+
+	from := t.TempDir()
+	entry, err := PullScaffold(repo, SourceOptions{Cache: NewRepoCache(from)})
+	if err != nil {
+		t.Fatalf("PullScaffold() error = %v", err)
+	}
+	index := &CacheIndex{}
+	index.Add(entry)
+	if err = index.Save(CacheIndexPath(from)); err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	if err = ExportCache(from, &exported); err != nil {
+		t.Fatalf("ExportCache() error = %v", err)
+	}
+
+	// import into a cache that already has an entry and a stale mirror of the same repository
+	to := t.TempDir()
+	if _, err = PullScaffold(repo, SourceOptions{Cache: NewRepoCache(to)}); err != nil {
+		t.Fatal(err)
+	}
+	existing := &CacheIndex{Scaffolds: []CacheIndexEntry{{Name: "other", Catalog: "test", PulledAt: time.Now()}}}
+	existing.Save(CacheIndexPath(to))
+
+	imported, err := ImportCache(to, &exported)
+	if err != nil {
+		t.Fatalf("ImportCache() error = %v", err)
+	}
+	if len(imported.Scaffolds) != 2 {
+		t.Errorf("ImportCache() got index %v, want both scaffolds", imported.Scaffolds)
+	}
+
+	source, _ := NewSource(repo, SourceOptions{Cache: NewRepoCache(to), Offline: true})
+	dest := t.TempDir()
+	if err = source.Fetch(dest); err != nil {
+		t.Fatalf("offline Fetch() from an imported cache error = %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+		t.Errorf("offline Fetch() from an imported cache didn't fetch flow.yml")
+	}
+
+	if err = ExportCache(filepath.Join(t.TempDir(), "missing"), &bytes.Buffer{}); err == nil {
+		t.Errorf("ExportCache() of a missing cache should fail")
+	}
+}
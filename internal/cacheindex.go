@@ -0,0 +1,140 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// cacheindex.go pre-seeds the cache with scaffolds, e.g. for laptops on planes or hermetic CI images,
+// recording what's been pulled in an index.
+
+const cacheIndexFile = "index.yml"
+
+type CacheIndex struct {
+	Scaffolds []CacheIndexEntry `yaml:"scaffolds"`
+}
+
+type CacheIndexEntry struct {
+	Name     string    `yaml:"name"`
+	Catalog  string    `yaml:"catalog"`
+	Location string    `yaml:"location"`
+	Ref      string    `yaml:"ref,omitempty"`
+	PulledAt time.Time `yaml:"pulled_at"`
+}
+
+// CacheIndexPath returns the location of the index within cacheDir
+func CacheIndexPath(cacheDir string) string {
+	return filepath.Join(cacheDir, cacheIndexFile)
+}
+
+// LoadCacheIndex reads the index at path - a missing index is treated as empty
+func LoadCacheIndex(path string) (*CacheIndex, error) {
+	index := &CacheIndex{}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(raw, index); err != nil {
+		return nil, fmt.Errorf("unable to parse cache index %v: %w", path, err)
+	}
+	return index, nil
+}
+
+func (i *CacheIndex) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	raw, err := yaml.Marshal(i)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
+
+// Add records entry, replacing any earlier entry for the same catalog and scaffold
+func (i *CacheIndex) Add(entry CacheIndexEntry) {
+	for n, existing := range i.Scaffolds {
+		if existing.Catalog == entry.Catalog && existing.Name == entry.Name {
+			i.Scaffolds[n] = entry
+			return
+		}
+	}
+	i.Scaffolds = append(i.Scaffolds, entry)
+	sort.Slice(i.Scaffolds, func(a, b int) bool {
+		if i.Scaffolds[a].Catalog != i.Scaffolds[b].Catalog {
+			return i.Scaffolds[a].Catalog < i.Scaffolds[b].Catalog
+		}
+		return i.Scaffolds[a].Name < i.Scaffolds[b].Name
+	})
+}
+
+// Merge adds every entry from other that was pulled more recently than ours
+func (i *CacheIndex) Merge(other *CacheIndex) {
+	for _, entry := range other.Scaffolds {
+		if existing, ok := i.get(entry.Catalog, entry.Name); ok && !existing.PulledAt.Before(entry.PulledAt) {
+			continue
+		}
+		i.Add(entry)
+	}
+}
+
+func (i *CacheIndex) get(catalog, name string) (CacheIndexEntry, bool) {
+	for _, entry := range i.Scaffolds {
+		if entry.Catalog == catalog && entry.Name == name {
+			return entry, true
+		}
+	}
+	return CacheIndexEntry{}, false
+}
+
+// pinnedRef describes the ref a scaffold is pinned to in its manifest, or the override if there is one
+func pinnedRef(repo ScaffoldRepo, override string) string {
+	switch {
+	case override != "":
+		return override
+	case repo.Commit != "":
+		return "commit " + repo.Commit
+	case repo.Tag != "":
+		return "tag " + repo.Tag
+	case repo.Version != "":
+		return "version " + repo.Version
+	case repo.Branch != "":
+		return "branch " + repo.Branch
+	}
+	return ""
+}
+
+// PullScaffold fetches a scaffold at its pinned ref, so that its source is in options.Cache for later offline use
+func PullScaffold(repo ScaffoldRepo, options SourceOptions) (CacheIndexEntry, error) {
+	if options.Cache == nil {
+		return CacheIndexEntry{}, errors.New("scaffolds can only be pulled into a cache")
+	}
+	source, err := NewSource(repo, options)
+	if err != nil {
+		return CacheIndexEntry{}, err
+	}
+	staging, err := os.MkdirTemp("", "lagoon-scaffold-pull")
+	if err != nil {
+		return CacheIndexEntry{}, err
+	}
+	defer os.RemoveAll(staging)
+
+	if err = source.Fetch(staging); err != nil {
+		return CacheIndexEntry{}, fmt.Errorf("unable to pull %v: %w", repo.Name, err)
+	}
+	return CacheIndexEntry{
+		Name:     repo.Name,
+		Catalog:  repo.Source,
+		Location: RedactUrl(source.String()),
+		Ref:      pinnedRef(repo, options.Ref),
+		PulledAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", cacheIndexFile)
+	index, err := LoadCacheIndex(path)
+	if err != nil || len(index.Scaffolds) != 0 {
+		t.Fatalf("LoadCacheIndex() of a missing index got = %v, %v", index, err)
+	}
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	index.Add(CacheIndexEntry{Name: "drupal", Catalog: "lagoon", Location: "https://example.com/drupal.git", PulledAt: old})
+	index.Add(CacheIndexEntry{Name: "drupal", Catalog: "internal", Location: "https://git.internal/drupal.git", PulledAt: old})
+	index.Add(CacheIndexEntry{Name: "drupal", Catalog: "lagoon", Location: "https://example.com/drupal-v2.git", PulledAt: old})
+	if len(index.Scaffolds) != 2 || index.Scaffolds[0].Catalog != "internal" || index.Scaffolds[1].Location != "https://example.com/drupal-v2.git" {
+		t.Fatalf("Add() got = %v", index.Scaffolds)
+	}
+	if err = index.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	other := &CacheIndex{Scaffolds: []CacheIndexEntry{
+		{Name: "drupal", Catalog: "lagoon", Location: "https://example.com/older.git", PulledAt: old.Add(-time.Hour)},
+		{Name: "laravel", Catalog: "lagoon", Location: "https://example.com/laravel.git", PulledAt: old},
+	}}
+	loaded, err := LoadCacheIndex(path)
+	if err != nil {
+		t.Fatalf("LoadCacheIndex() error = %v", err)
+	}
+	loaded.Merge(other)
+	if len(loaded.Scaffolds) != 3 {
+		t.Fatalf("Merge() got = %v, want 3 scaffolds", loaded.Scaffolds)
+	}
+	if entry, _ := loaded.get("lagoon", "drupal"); entry.Location != "https://example.com/drupal-v2.git" {
+		t.Errorf("Merge() replaced a newer entry with %v", entry)
+	}
+}
+
+func TestPullScaffold(t *testing.T) {
+	data := buildTarGz(t, []testArchiveEntry{{name: "scaffold/.lagoon/flow.yml", body: "questions: []"}})
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	gitDir, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, map[int]string{0: "v1.0.0"})
+	cache := NewRepoCache(t.TempDir())
+	repos := []ScaffoldRepo{
+		{Name: "archive", Source: "test", Archive: server.URL + "/scaffold.tar.gz", SHA256: checksum(data)},
+		{Name: "git", Source: "test", GitRepo: "file://" + gitDir, Tag: "v1.0.0"},
+	}
+
+	for _, repo := range repos {
+		entry, err := PullScaffold(repo, SourceOptions{Cache: cache})
+		if err != nil {
+			t.Fatalf("PullScaffold(%v) error = %v", repo.Name, err)
+		}
+		if entry.Name != repo.Name || entry.Catalog != "test" {
+			t.Errorf("PullScaffold(%v) got = %v", repo.Name, entry)
+		}
+	}
+	if entry, _ := PullScaffold(repos[1], SourceOptions{Cache: cache}); entry.Ref != "tag v1.0.0" {
+		t.Errorf("PullScaffold() got ref %v, want tag v1.0.0", entry.Ref)
+	}
+
+	// everything pulled should now be available offline
+	for _, repo := range repos {
+		source, err := NewSource(repo, SourceOptions{Cache: cache, Offline: true})
+		if err != nil {
+			t.Fatalf("NewSource(%v) error = %v", repo.Name, err)
+		}
+		dest := t.TempDir()
+		if err = source.Fetch(dest); err != nil {
+			t.Fatalf("offline Fetch(%v) error = %v", repo.Name, err)
+		}
+		if _, err = os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+			t.Errorf("offline Fetch(%v) didn't fetch flow.yml", repo.Name)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("archive was requested %d times, want 1", requests)
+	}
+
+	if _, err := PullScaffold(repos[0], SourceOptions{}); err == nil {
+		t.Errorf("PullScaffold() without a cache should fail")
+	}
+}
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// computed.go deals with `computed` questions, which are never asked - their value is rendered from a
+// template over the answers before them, e.g.
+//
+//	- name: databaseName
+//	  type: computed
+//	  value: '{{ slugify .projectName | printf "%s_db" }}'
+
+// computedValueTypes are the types a computed value can be converted to, and the question type
+// whose answers are converted the same way
+var computedValueTypes = map[string]string{
+	"":       "text",
+	"string": "text",
+	"bool":   "confirm",
+	"number": "number",
+}
+
+// computedValue renders a computed question's value, converting it to its value_type
+func (q surveyQuestion) computedValue(scopes []interface{}, data FlowData) (interface{}, error) {
+	rendered, err := renderWithAnswers(q.Name, q.Value, scopes, data)
+	if err != nil {
+		return nil, err
+	}
+	if q.ValueType != "" && q.ValueType != "string" {
+		rendered = strings.TrimSpace(rendered)
+	}
+	return surveyQuestion{Type: computedValueTypes[q.ValueType]}.typedValue(rendered)
+}
+
+// checkComputed checks a computed question's value template and value_type
+func (q surveyQuestion) checkComputed() error {
+	if q.Type != "computed" {
+		if q.Value != "" || q.ValueType != "" {
+			return fmt.Errorf("question `%v`: only computed questions can have a `value`", q.Name)
+		}
+		return nil
+	}
+	if q.Value == "" {
+		return fmt.Errorf("computed question `%v` needs a `value`", q.Name)
+	}
+	if _, ok := computedValueTypes[q.ValueType]; !ok {
+		return fmt.Errorf("computed question `%v` has an unknown value_type `%v` - use string, bool or number", q.Name, q.ValueType)
+	}
+	if _, err := GetTemplate(q.Name).Parse(q.Value); err != nil {
+		return fmt.Errorf("computed question `%v` has an invalid value: %w", q.Name, err)
+	}
+	return nil
+}
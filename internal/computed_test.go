@@ -0,0 +1,156 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const computedFlow = `
+questions:
+- name: projectName
+  type: text
+  default: My Site
+- name: database
+  type: select
+  options: [mariadb, postgres]
+  default: postgres
+- name: projectMachineName
+  type: computed
+  value: '{{ slugify .projectName }}'
+- name: databaseName
+  type: computed
+  value: '{{ slugify .projectName | printf "%s_db" }}'
+- name: usePostgres
+  type: computed
+  value_type: bool
+  value: '{{ eq .database "postgres" }}'
+- name: postgresPort
+  type: computed
+  value_type: number
+  value: 5432
+  when: usePostgres
+- name: solr
+  type: conditional
+  questions:
+  - name: core
+    type: computed
+    value: '{{ .projectMachineName }}-core'
+`
+
+func TestRunFromSurveyQuestionsComputed(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(computedFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RunFromSurveyQuestionsWithData(questions, false, FlowData{})
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestionsWithData() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"projectName":        "My Site",
+		"database":           "postgres",
+		"projectMachineName": "my-site",
+		"databaseName":       "my-site_db",
+		"usePostgres":        true,
+		"postgresPort":       5432,
+		"solr": map[string]interface{}{
+			"answer": false,
+			"core":   "my-site-core",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFromSurveyQuestionsWithData() got = %#v, want %#v", got, want)
+	}
+}
+
+func TestValidateValuesComputes(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(computedFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values interface{}
+	err = yaml.Unmarshal([]byte("projectName: Other Site\ndatabase: mariadb\nusePostgres: true\nsolr:\n  answer: true\n"), &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ValidateValues(questions, values, FlowData{}); err != nil {
+		t.Fatalf("ValidateValues() error = %v", err)
+	}
+	want := map[interface{}]interface{}{
+		"projectName":        "Other Site",
+		"database":           "mariadb",
+		"projectMachineName": "other-site",
+		"databaseName":       "other-site_db",
+		"usePostgres":        false, // computed values are always recomputed
+		"solr": map[interface{}]interface{}{
+			"answer": true,
+			"core":   "other-site-core",
+		},
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("ValidateValues() got = %#v, want %#v", values, want)
+	}
+}
+
+func TestCheckComputed(t *testing.T) {
+	tests := map[string]string{
+		"no value":           "questions:\n- name: a\n  type: computed\n",
+		"unknown value_type": "questions:\n- name: a\n  type: computed\n  value: x\n  value_type: list\n",
+		"invalid template":   "questions:\n- name: a\n  type: computed\n  value: '{{ .b '\n",
+		"value on a prompt":  "questions:\n- name: a\n  type: text\n  value: x\n",
+	}
+	for name, flow := range tests {
+		if _, err := UnmarshallSurveyQuestions([]byte(flow)); err == nil {
+			t.Errorf("UnmarshallSurveyQuestions() with %v expected an error", name)
+		}
+	}
+
+	questions, err := UnmarshallSurveyQuestions([]byte("questions:\n- name: a\n  type: computed\n  value_type: number\n  value: lots\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RunFromSurveyQuestions(questions, false); err == nil || !strings.Contains(err.Error(), "is not a whole number") {
+		t.Errorf("RunFromSurveyQuestions() with a computed value of the wrong type got error = %v", err)
+	}
+}
+
+func TestValidateValuesWhenComputed(t *testing.T) {
+	// a `when` over a computed value must see it in --values, just as it does when the flow is run
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: database
+  type: select
+  options: [mariadb, postgres]
+  default: mariadb
+- name: isPostgres
+  type: computed
+  value: '{{ eq .database "postgres" }}'
+  value_type: bool
+- name: pgPassword
+  type: text
+  required: true
+  when: isPostgres
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for values, want := range map[string]string{
+		"database: mariadb\n":                      "",
+		"database: postgres\npgPassword: s3cret\n": "",
+		"database: postgres\n":                     "question `pgPassword`: a value is required",
+	} {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(values), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := ValidateValues(questions, parsed, FlowData{}); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("ValidateValues(%q) got = %q, want %q", values, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// config.go deals with the user's persistent configuration - registered catalogs and the like.
+
+const configDirName = "lagoon-scaffold"
+
+type Catalog struct {
+	Name     string `yaml:"name"`
+	Location string `yaml:"location"`
+	// PublicKeys are minisign public keys, at least one of which must have signed the catalog's manifest
+	PublicKeys  []string            `yaml:"public_keys,omitempty"`
+	Credentials ManifestCredentials `yaml:",inline"`
+	// Git credentials are used for scaffolds listed in the catalog, and for a catalog in a git repository
+	Git GitCredentials `yaml:"git,omitempty"`
+}
+
+func (c Catalog) ManifestSource() ManifestSource {
+	return ManifestSource{Name: c.Name, Location: c.Location, PublicKeys: c.PublicKeys, Credentials: c.Credentials}
+}
+
+type Config struct {
+	Catalogs []Catalog `yaml:"catalogs,omitempty"`
+	// ManifestTTL is how long fetched manifests are cached before being revalidated, e.g. "30m"
+	ManifestTTL string `yaml:"manifest_ttl,omitempty"`
+	// CAFile is a PEM bundle of extra certificate authorities to trust for manifests, archives and git over https
+	CAFile string `yaml:"ca_file,omitempty"`
+	// Proxy is used for all http(s) requests in place of the HTTPS_PROXY/HTTP_PROXY environment variables
+	Proxy string `yaml:"proxy,omitempty"`
+	// KnownHosts is the known_hosts file ssh host keys are verified against, in place of ~/.ssh/known_hosts
+	KnownHosts string `yaml:"known_hosts,omitempty"`
+	// Rewrites redirect manifest, git and archive urls, e.g. to an internal mirror
+	Rewrites []URLRewrite `yaml:"rewrites,omitempty"`
+}
+
+// DefaultConfigPath returns the location of the user's config file, typically ~/.config/lagoon-scaffold/config.yml
+func DefaultConfigPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, configDirName, "config.yml"), nil
+}
+
+// DefaultCacheDir returns the directory fetched manifests and the like are cached in
+func DefaultCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, configDirName), nil
+}
+
+// LoadConfig reads the config file at path - a missing file is treated as an empty config
+func LoadConfig(path string) (*Config, error) {
+	config := &Config{}
+	dat, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(dat, config); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %v: %w", path, err)
+	}
+	return config, nil
+}
+
+func (c *Config) Save(path string) error {
+	dat, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(path, dat)
+}
+
+// writePrivateFile writes data only the user can read, for files holding credentials or anything fetched with them.
+// Files and directories written before are tightened up too.
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+func (c *Config) GetCatalog(name string) (Catalog, bool) {
+	for _, catalog := range c.Catalogs {
+		if catalog.Name == name {
+			return catalog, true
+		}
+	}
+	return Catalog{}, false
+}
+
+func (c *Config) AddCatalog(catalog Catalog) error {
+	if catalog.Name == "" || strings.Contains(catalog.Name, "/") {
+		return fmt.Errorf("invalid catalog name `%v` - names must be non-empty and cannot contain `/`", catalog.Name)
+	}
+	if catalog.Name == DefaultSourceName {
+		return fmt.Errorf("`%v` is reserved for the default Lagoon catalog", catalog.Name)
+	}
+	if catalog.Location == "" {
+		return errors.New("a catalog requires a manifest path or url")
+	}
+	if _, exists := c.GetCatalog(catalog.Name); exists {
+		return fmt.Errorf("catalog `%v` already exists", catalog.Name)
+	}
+	if _, err := ParsePublicKeys(catalog.PublicKeys); err != nil {
+		return err
+	}
+	c.Catalogs = append(c.Catalogs, catalog)
+	return nil
+}
+
+func (c *Config) RemoveCatalog(name string) error {
+	for i, catalog := range c.Catalogs {
+		if catalog.Name == name {
+			c.Catalogs = append(c.Catalogs[:i], c.Catalogs[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("catalog `%v` does not exist", name)
+}
+
+// GitCredentials returns the git credentials configured for each catalog, by name
+func (c *Config) GitCredentials() map[string]GitCredentials {
+	credentials := map[string]GitCredentials{}
+	for _, catalog := range c.Catalogs {
+		credentials[catalog.Name] = catalog.Git
+	}
+	return credentials
+}
+
+// GetManifestTTL returns the configured manifest cache TTL, or DefaultManifestTTL if none is set
+func (c *Config) GetManifestTTL() (time.Duration, error) {
+	if c.ManifestTTL == "" {
+		return DefaultManifestTTL, nil
+	}
+	ttl, err := time.ParseDuration(c.ManifestTTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid manifest_ttl `%v`: %w", c.ManifestTTL, err)
+	}
+	return ttl, nil
+}
+
+// ManifestSources returns the registered catalogs as manifest sources, in the order they were added
+func (c *Config) ManifestSources() []ManifestSource {
+	var sources []ManifestSource
+	for _, catalog := range c.Catalogs {
+		sources = append(sources, catalog.ManifestSource())
+	}
+	return sources
+}
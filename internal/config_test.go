@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConfigCatalogs(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "nested", "config.yml")
+
+	config, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() on missing file error = %v", err)
+	}
+	if len(config.Catalogs) != 0 {
+		t.Fatalf("LoadConfig() on missing file got %v catalogs, want 0", len(config.Catalogs))
+	}
+
+	if err = config.AddCatalog(Catalog{Name: "internal", Location: "https://example.com/scaffolds.yml", Credentials: ManifestCredentials{Token: "${TOKEN}"}}); err != nil {
+		t.Fatalf("AddCatalog() error = %v", err)
+	}
+	if err = config.AddCatalog(Catalog{Name: "project", Location: "./scaffolds.yml"}); err != nil {
+		t.Fatalf("AddCatalog() error = %v", err)
+	}
+	for _, name := range []string{"internal", DefaultSourceName, "bad/name", ""} {
+		if err = config.AddCatalog(Catalog{Name: name, Location: "./scaffolds.yml"}); err == nil {
+			t.Errorf("AddCatalog(%q) expected an error", name)
+		}
+	}
+
+	if err = config.Save(configPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("LoadConfig() got = %v, want %v", loaded, config)
+	}
+
+	if err = loaded.RemoveCatalog("internal"); err != nil {
+		t.Fatalf("RemoveCatalog() error = %v", err)
+	}
+	if err = loaded.RemoveCatalog("internal"); err == nil {
+		t.Errorf("RemoveCatalog() of a missing catalog expected an error")
+	}
+	want := []ManifestSource{{Name: "project", Location: "./scaffolds.yml"}}
+	if got := loaded.ManifestSources(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ManifestSources() got = %v, want %v", got, want)
+	}
+}
+
+func TestConfigSaveIsPrivate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "lagoon-scaffold")
+	configPath := filepath.Join(dir, "config.yml")
+	// a config saved by an earlier version is tightened up too
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte("catalogs: []\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{}
+	if err := config.AddCatalog(Catalog{Name: "internal", Location: "https://example.com/scaffolds.yml", Credentials: ManifestCredentials{Token: "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Save(configPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	cache := NewManifestCache(filepath.Join(t.TempDir(), "manifests"), time.Hour)
+	if err := cache.Put([]byte(cacheTestManifest), &manifestCacheMeta{Url: "https://example.com/scaffolds.yml"}); err != nil {
+		t.Fatalf("cache.Put() error = %v", err)
+	}
+	bodyPath, metaPath := cache.paths("https://example.com/scaffolds.yml")
+
+	for path, want := range map[string]os.FileMode{dir: 0700, configPath: 0600, cache.Dir: 0700, bodyPath: 0600, metaPath: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%v has permissions %v, want %v", path, got, want)
+		}
+	}
+}
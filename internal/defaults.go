@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaults.go renders templated question defaults, e.g.
+//
+//	default: '{{ slugify .projectName }}'
+//
+// against the answers given so far, along with some helper data about where the scaffold is going.
+
+// FlowData is the helper data templated defaults are rendered with, alongside earlier answers
+type FlowData struct {
+	Env       map[string]string // environment variables, e.g. {{ .Env.USER }}
+	TargetDir string            // the name of the directory the scaffold is written to
+	GitEmail  string            // git's user.email, if it's configured
+}
+
+// NewFlowData gathers the helper data for a scaffold being written to targetDirectory
+func NewFlowData(targetDirectory string) FlowData {
+	data := FlowData{Env: map[string]string{}}
+	for _, variable := range os.Environ() {
+		if name, value, ok := strings.Cut(variable, "="); ok {
+			data.Env[name] = value
+		}
+	}
+	dir, err := filepath.Abs(targetDirectory)
+	if err == nil {
+		data.TargetDir = filepath.Base(dir)
+	}
+	// run in the target directory, so that its repository's config is used if it has one
+	cmd := exec.Command("git", "config", "user.email")
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		cmd.Dir = dir
+	}
+	if email, err := cmd.Output(); err == nil {
+		data.GitEmail = strings.TrimSpace(string(email))
+	}
+	return data
+}
+
+// isTemplatedDefault is true for string defaults containing template actions
+func isTemplatedDefault(def interface{}) bool {
+	s, ok := def.(string)
+	return ok && strings.Contains(s, "{{")
+}
+
+// resolveDefault renders the question's default, if it's templated, and converts it to the type of the question's answers
+func (q surveyQuestion) resolveDefault(scopes []interface{}, data FlowData) (interface{}, error) {
+	if !isTemplatedDefault(q.Default) {
+		return q.typedValue(q.Default)
+	}
+	rendered, err := renderWithAnswers(q.Name, q.Default.(string), scopes, data)
+	if err != nil {
+		return nil, err
+	}
+	return q.typedValue(rendered)
+}
+
+// renderWithAnswers renders text as a template with the answers in scopes and the helper data
+func renderWithAnswers(name string, text string, scopes []interface{}, data FlowData) (string, error) {
+	tmpl, err := GetTemplate(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, defaultsData(scopes, data)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// defaultsData merges the helper data with the answers in scopes - answers take precedence over the
+// helper data, and inner scopes (i.e. conditionals) over outer ones
+func defaultsData(scopes []interface{}, data FlowData) map[string]interface{} {
+	merged := map[string]interface{}{
+		"Env":       data.Env,
+		"TargetDir": data.TargetDir,
+		"GitEmail":  data.GitEmail,
+	}
+	for _, scope := range scopes {
+		switch scope := scope.(type) {
+		case map[string]interface{}:
+			for k, v := range scope {
+				merged[k] = v
+			}
+		case map[interface{}]interface{}:
+			for k, v := range scope {
+				merged[fmt.Sprint(k)] = v
+			}
+		}
+	}
+	return merged
+}
@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRunFromSurveyQuestionsWithDataTemplatedDefaults(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: projectName
+  type: text
+  default: '{{ .TargetDir }}'
+- name: projectMachineName
+  type: text
+  default: '{{ slugify .projectName }}'
+  validate:
+  - allowed_chars: a-z0-9-
+- name: maintainer
+  type: text
+  default: '{{ with .GitEmail }}{{ . }}{{ else }}{{ .Env.USER }}@example.com{{ end }}'
+- name: replicas
+  type: number
+  default: '{{ if eq .projectMachineName "my-site" }}3{{ else }}1{{ end }}'
+- name: database
+  type: conditional
+  questions:
+  - name: databaseName
+    type: text
+    default: '{{ .projectMachineName }}_db'
+  - name: databaseUser
+    type: text
+    default: '{{ .databaseName }}_user'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := FlowData{Env: map[string]string{"USER": "jo"}, TargetDir: "My Site"}
+	got, err := RunFromSurveyQuestionsWithData(questions, false, data)
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestionsWithData() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"projectName":        "My Site",
+		"projectMachineName": "my-site",
+		"maintainer":         "jo@example.com",
+		"replicas":           3,
+		"database": map[string]interface{}{
+			"answer":       false,
+			"databaseName": "my-site_db",
+			"databaseUser": "my-site_db_user",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFromSurveyQuestionsWithData() got = %#v, want %#v", got, want)
+	}
+
+	data.GitEmail = "jo@lagoon.sh"
+	got, err = RunFromSurveyQuestionsWithData(questions, false, data)
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestionsWithData() error = %v", err)
+	}
+	if maintainer := got.(map[string]interface{})["maintainer"]; maintainer != "jo@lagoon.sh" {
+		t.Errorf("RunFromSurveyQuestionsWithData() got maintainer = %v, want jo@lagoon.sh", maintainer)
+	}
+}
+
+func TestTemplatedDefaultErrors(t *testing.T) {
+	if _, err := UnmarshallSurveyQuestions([]byte("questions:\n- name: a\n  type: text\n  default: '{{ .b '\n")); err == nil {
+		t.Errorf("UnmarshallSurveyQuestions() with an unparseable default expected an error")
+	}
+
+	// a templated default is only typed once it's rendered
+	questions, err := UnmarshallSurveyQuestions([]byte("questions:\n- name: a\n  type: number\n  default: '{{ .TargetDir }}'\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = RunFromSurveyQuestionsWithData(questions, false, FlowData{TargetDir: "site"})
+	if err == nil || err.Error() != "question `a` has an invalid default: `site` is not a whole number" {
+		t.Errorf("RunFromSurveyQuestionsWithData() with a default rendering to the wrong type got error = %v", err)
+	}
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"fmt"
 	"github.com/fatih/color"
+	"slices"
+	"strings"
 )
 
 func printColor(depth int, s string) string {
@@ -34,7 +36,19 @@ func FlowToGraph(depth int, questions []surveyQuestion) (string, error) {
 	}
 	for _, question := range questions {
 		questionFormatted := printColor(depth, fmt.Sprintf("| %s:%s", question.Name, question.Prompt))
+		if question.Type == "computed" {
+			questionFormatted = printColor(depth, fmt.Sprintf("| %s = %s", question.Name, question.Value))
+		}
 		graph += fmt.Sprintf("%s%s\n", repeatColorWithDepth("|  ", depth), questionFormatted)
+		if question.When != "" {
+			// questions asked depending on earlier answers show an edge back to them
+			expr, err := parseWhen(question.When)
+			if err != nil {
+				return "", fmt.Errorf("question `%v` has an invalid when `%v`: %w", question.Name, question.When, err)
+			}
+			edge := printColor(depth, fmt.Sprintf("|   <- %s (when %s)", strings.Join(uniqueStrings(whenNames(expr)), ", "), question.When))
+			graph += fmt.Sprintf("%s%s\n", repeatColorWithDepth("|  ", depth), edge)
+		}
 		if question.Type == "conditional" {
 			conditionalGraph, err := FlowToGraph(depth+1, question.Questions)
 			if err != nil {
@@ -48,3 +62,13 @@ func FlowToGraph(depth int, questions []surveyQuestion) (string, error) {
 	}
 	return graph, nil
 }
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
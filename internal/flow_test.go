@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFlowToGraphWhen(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: database
+  type: select
+  prompt: Which database?
+  options: [mariadb, postgres]
+- name: version
+  type: text
+  prompt: Which version?
+  when: database == "postgres" || database == "mariadb"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := FlowToGraph(0, questions)
+	if err != nil {
+		t.Fatalf("FlowToGraph() error = %v", err)
+	}
+	want := `| version:Which version?
+|   <- database (when database == "postgres" || database == "mariadb")`
+	if !strings.Contains(graph, want) {
+		t.Errorf("FlowToGraph() got =\n%v\nwant it to contain\n%v", graph, want)
+	}
+}
+
+func TestFlowToGraphComputed(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(computedFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := FlowToGraph(0, questions)
+	if err != nil {
+		t.Fatalf("FlowToGraph() error = %v", err)
+	}
+	for _, want := range []string{"| projectMachineName = {{ slugify .projectName }}\n", "|   <- usePostgres (when usePostgres)\n"} {
+		if !strings.Contains(graph, want) {
+			t.Errorf("FlowToGraph() got =\n%v\nwant it to contain\n%v", graph, want)
+		}
+	}
+}
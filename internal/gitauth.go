@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gitauth.go works out how to authenticate to the git repositories scaffolds (and manifests) live in.
+
+const (
+	// SSHPassphraseEnvVar holds the passphrase for an encrypted ssh key
+	SSHPassphraseEnvVar = "LAGOON_SCAFFOLD_SSH_PASSPHRASE"
+	// GitTokenEnvVar holds a token for git over https
+	GitTokenEnvVar = "LAGOON_SCAFFOLD_GIT_TOKEN"
+	// GitUsernameEnvVar and GitPasswordEnvVar hold basic auth credentials for git over https
+	GitUsernameEnvVar = "LAGOON_SCAFFOLD_GIT_USERNAME"
+	GitPasswordEnvVar = "LAGOON_SCAFFOLD_GIT_PASSWORD"
+	// GitHostsEnvVar lists the hosts, separated by commas, that the token or password in the environment are sent to
+	GitHostsEnvVar = "LAGOON_SCAFFOLD_GIT_HOSTS"
+)
+
+// GitCredentials configure how we authenticate to git repositories.
+// ${VAR} references in the passphrase, password and token are expanded from the environment.
+type GitCredentials struct {
+	// SSHKey is the path of a private key - without one, ssh-agent is used
+	SSHKey        string `yaml:"ssh_key,omitempty"`
+	SSHPassphrase string `yaml:"ssh_passphrase,omitempty"`
+	Username      string `yaml:"username,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	// Token is used as the password for git over https
+	Token string `yaml:"token,omitempty"`
+}
+
+// merge returns c, with its ssh and/or https credentials replaced by override's, if it has any
+func (c GitCredentials) merge(override GitCredentials) GitCredentials {
+	if override.SSHKey != "" {
+		c.SSHKey, c.SSHPassphrase = override.SSHKey, override.SSHPassphrase
+	}
+	if override.Username != "" || override.Password != "" || override.Token != "" {
+		c.Username, c.Password, c.Token = override.Username, override.Password, override.Token
+	}
+	return c
+}
+
+type GitAuthenticator struct {
+	// Credentials are used for every repository, unless overridden by the repository's catalog
+	Credentials GitCredentials
+	// Catalogs holds credentials for repositories listed in (or manifests read from) each catalog
+	Catalogs map[string]GitCredentials
+	// Passphrase, if set, is asked for the passphrase of an encrypted ssh key that isn't otherwise given
+	Passphrase func(keyFile string) (string, error)
+	// CredentialHelpers asks git's credential helpers for https credentials that aren't otherwise given,
+	// once the server has asked for them
+	CredentialHelpers bool
+	// KnownHosts are the files ssh host keys are verified against - DefaultKnownHostsFiles if empty.
+	// Hosts trusted with TrustHost are added to the first.
+	KnownHosts []string
+	// TrustHost, if set, is asked whether to trust a host that isn't in KnownHosts - otherwise unknown hosts are refused
+	TrustHost func(hostname string, key ssh.PublicKey) (bool, error)
+
+	passphrases sync.Map
+}
+
+// Auth returns the auth method for url, which belongs to the given catalog (if any). A nil method means no auth.
+// For ssh we use the configured key, then ssh-agent, then the default keys in ~/.ssh. For https
+// we use the configured token or username and password, then the environment's if url is on one of the hosts they're
+// for - git's credential helpers are only asked once the server wants credentials, see withChallenge.
+func (a *GitAuthenticator) Auth(catalog string, url string) (transport.AuthMethod, error) {
+	return a.auth(catalog, url, "")
+}
+
+// ScaffoldAuth returns the auth method for a scaffold's git repository, verifying the pinned host key if it has one
+func (a *GitAuthenticator) ScaffoldAuth(repo ScaffoldRepo) (transport.AuthMethod, error) {
+	return a.auth(repo.Source, repo.GitRepo, repo.HostKey)
+}
+
+func (a *GitAuthenticator) auth(catalog string, url string, hostKey string) (transport.AuthMethod, error) {
+	endpoint, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, err
+	}
+	credentials := a.Credentials.merge(a.Catalogs[catalog])
+	switch endpoint.Protocol {
+	case "ssh":
+		auth, err := a.sshAuth(endpoint, credentials)
+		if err != nil {
+			return nil, err
+		}
+		port := endpoint.Port
+		if port == 0 {
+			port = 22
+		}
+		return a.verifyHostKey(auth, net.JoinHostPort(endpoint.Host, strconv.Itoa(port)), hostKey)
+	case "http", "https":
+		return a.httpAuth(endpoint, credentials), nil
+	}
+	return nil, nil
+}
+
+func (a *GitAuthenticator) sshAuth(endpoint *transport.Endpoint, credentials GitCredentials) (gitssh.AuthMethod, error) {
+	user := endpoint.User
+	if user == "" {
+		user = "git"
+	}
+	if credentials.SSHKey != "" {
+		return a.sshKeyAuth(user, credentials.SSHKey, os.ExpandEnv(credentials.SSHPassphrase))
+	}
+	agentAuth, agentErr := gitssh.NewSSHAgentAuth(user)
+	if agentErr == nil {
+		return agentAuth, nil
+	}
+	home, err := os.UserHomeDir()
+	if err == nil {
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			keyFile := filepath.Join(home, ".ssh", name)
+			if _, err := os.Stat(keyFile); err == nil {
+				return a.sshKeyAuth(user, keyFile, os.ExpandEnv(credentials.SSHPassphrase))
+			}
+		}
+	}
+	return nil, fmt.Errorf("no ssh key was given, and ssh-agent isn't available (%v) - use --privatekey to choose a key", agentErr)
+}
+
+func (a *GitAuthenticator) sshKeyAuth(user string, keyFile string, passphrase string) (gitssh.AuthMethod, error) {
+	pem, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ssh key: %w", err)
+	}
+	_, err = ssh.ParsePrivateKey(pem)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, err = a.passphrase(keyFile, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to parse ssh key %v: %w", keyFile, err)
+	}
+	keys, err := gitssh.NewPublicKeys(user, pem, passphrase)
+	if err != nil {
+		a.passphrases.Delete(keyFile)
+		return nil, fmt.Errorf("unable to use ssh key %v: %w", keyFile, err)
+	}
+	return keys, nil
+}
+
+// passphrase returns the passphrase for an encrypted key - the configured one, or from the environment, or by asking
+func (a *GitAuthenticator) passphrase(keyFile string, configured string) (string, error) {
+	if configured != "" {
+		return configured, nil
+	}
+	if passphrase := os.Getenv(SSHPassphraseEnvVar); passphrase != "" {
+		return passphrase, nil
+	}
+	if passphrase, ok := a.passphrases.Load(keyFile); ok {
+		return passphrase.(string), nil
+	}
+	if a.Passphrase == nil {
+		return "", fmt.Errorf("ssh key %v is encrypted - set %v to its passphrase", keyFile, SSHPassphraseEnvVar)
+	}
+	passphrase, err := a.Passphrase(keyFile)
+	if err != nil {
+		return "", err
+	}
+	a.passphrases.Store(keyFile, passphrase)
+	return passphrase, nil
+}
+
+func (a *GitAuthenticator) httpAuth(endpoint *transport.Endpoint, credentials GitCredentials) transport.AuthMethod {
+	if endpoint.User != "" && endpoint.Password != "" {
+		// go-git uses credentials in the url itself
+		return nil
+	}
+	// the environment's credentials would otherwise go to whichever server a manifest names
+	var env GitCredentials
+	if isGitCredentialsHost(endpoint) {
+		env = GitCredentials{Username: os.Getenv(GitUsernameEnvVar), Password: os.Getenv(GitPasswordEnvVar), Token: os.Getenv(GitTokenEnvVar)}
+	}
+	username := firstNonEmpty(os.ExpandEnv(credentials.Username), env.Username, endpoint.User)
+	if token := firstNonEmpty(os.ExpandEnv(credentials.Token), env.Token); token != "" {
+		// most servers accept a token as the password with any username
+		return &githttp.BasicAuth{Username: firstNonEmpty(username, "git"), Password: token}
+	}
+	if password := firstNonEmpty(os.ExpandEnv(credentials.Password), env.Password); password != "" {
+		return &githttp.BasicAuth{Username: username, Password: password}
+	}
+	return nil
+}
+
+// isGitCredentialsHost is true if endpoint is on one of the hosts listed in GitHostsEnvVar
+func isGitCredentialsHost(endpoint *transport.Endpoint) bool {
+	hostWithPort := net.JoinHostPort(endpoint.Host, strconv.Itoa(endpoint.Port))
+	for _, host := range strings.Split(os.Getenv(GitHostsEnvVar), ",") {
+		host = strings.TrimSpace(host)
+		if host != "" && (strings.EqualFold(host, endpoint.Host) || strings.EqualFold(host, hostWithPort)) {
+			return true
+		}
+	}
+	return false
+}
+
+// withChallenge runs op with auth, then - if the server asked for the credentials we didn't send - once more with
+// credentials from git's credential helpers. Like git, we don't ask the helpers about repositories that don't need
+// them. It returns the auth method op last used, for any later requests to the same repository.
+func (a *GitAuthenticator) withChallenge(catalog string, url string, auth transport.AuthMethod, op func(auth transport.AuthMethod) error) (transport.AuthMethod, error) {
+	err := op(auth)
+	if a == nil || !a.CredentialHelpers || auth != nil || !errors.Is(err, transport.ErrAuthenticationRequired) {
+		return auth, err
+	}
+	endpoint, endpointErr := transport.NewEndpoint(url)
+	if endpointErr != nil || (endpoint.Protocol != "http" && endpoint.Protocol != "https") || endpoint.Password != "" {
+		return auth, err
+	}
+	username := firstNonEmpty(os.ExpandEnv(a.Credentials.merge(a.Catalogs[catalog]).Username), endpoint.User)
+	username, password, ok := gitCredentialFill(endpoint, username)
+	if !ok {
+		return auth, err
+	}
+	auth = &githttp.BasicAuth{Username: username, Password: password}
+	return auth, op(auth)
+}
+
+// gitCredentialFill asks git's configured credential helpers for credentials, without ever prompting
+func gitCredentialFill(endpoint *transport.Endpoint, username string) (string, string, bool) {
+	host := endpoint.Host
+	if endpoint.Port != 0 {
+		host = fmt.Sprintf("%v:%v", endpoint.Host, endpoint.Port)
+	}
+	input := fmt.Sprintf("protocol=%v\nhost=%v\npath=%v\n", endpoint.Protocol, host, strings.TrimPrefix(endpoint.Path, "/"))
+	if username != "" {
+		input += "username=" + username + "\n"
+	}
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input + "\n")
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ASKPASS=", "SSH_ASKPASS=")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		return "", "", false
+	}
+	values := map[string]string{}
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		if key, value, found := strings.Cut(line, "="); found {
+			values[key] = value
+		}
+	}
+	if values["password"] == "" {
+		return "", "", false
+	}
+	return values["username"], values["password"], true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
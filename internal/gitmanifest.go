@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"io"
+	"os"
+	"strings"
+)
+
+// gitmanifest.go reads manifests straight out of git repositories, so that private manifests can live
+// alongside private scaffolds. Locations look like git+ssh://git@github.com/org/repo.git#ref:path/to/scaffolds.yml
+// where the ref is optional, i.e. `#:scaffolds.yml` or `#scaffolds.yml` read from the default branch.
+
+const gitManifestPrefix = "git+"
+
+// StdinManifestLocation is the location used to read a manifest from stdin
+const StdinManifestLocation = "-"
+
+// manifestStdin is where manifests are read from for StdinManifestLocation
+var manifestStdin io.Reader = os.Stdin
+
+func isGitManifestLocation(location string) bool {
+	return strings.HasPrefix(location, gitManifestPrefix)
+}
+
+// rewriteManifestLocation rewrites a manifest url, or the repository of a git manifest, with rewriter
+func rewriteManifestLocation(location string, rewriter *URLRewriter) string {
+	if !isGitManifestLocation(location) {
+		return rewriter.Rewrite(location)
+	}
+	repository, fragment, found := strings.Cut(strings.TrimPrefix(location, gitManifestPrefix), "#")
+	if !found {
+		return location
+	}
+	return gitManifestPrefix + rewriter.Rewrite(repository) + "#" + fragment
+}
+
+type gitManifestLocation struct {
+	Repository string
+	Ref        string
+	Path       string
+}
+
+func parseGitManifestLocation(location string) (gitManifestLocation, error) {
+	repository, fragment, found := strings.Cut(strings.TrimPrefix(location, gitManifestPrefix), "#")
+	if !found || fragment == "" {
+		return gitManifestLocation{}, fmt.Errorf("git manifest %v must end with #ref:path/to/manifest.yml", location)
+	}
+	parsed := gitManifestLocation{Repository: repository, Path: fragment}
+	if ref, path, found := strings.Cut(fragment, ":"); found {
+		parsed.Ref, parsed.Path = ref, path
+	}
+	parsed.Path = strings.TrimPrefix(parsed.Path, "/")
+	if parsed.Path == "" {
+		return gitManifestLocation{}, fmt.Errorf("git manifest %v doesn't specify a path", location)
+	}
+	return parsed, nil
+}
+
+// getManifestFromGit clones the manifest's repository into memory and reads the manifest from the resolved ref
+func getManifestFromGit(location string, options ManifestOptions) (*manifestResponse, error) {
+	parsed, err := parseGitManifestLocation(location)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := options.requestContext()
+	defer cancel()
+
+	auth, err := options.gitAuth(parsed.Repository)
+	if err != nil {
+		return nil, err
+	}
+	repo := ScaffoldRepo{GitRepo: parsed.Repository}
+	var ref ResolvedRef
+	auth, err = options.GitAuthenticator.withChallenge(options.catalog, parsed.Repository, auth, func(auth transport.AuthMethod) (err error) {
+		ref, err = ResolveRefContext(ctx, repo, parsed.Ref, auth)
+		return err
+	})
+	if err != nil {
+		return nil, &ManifestNetworkError{Location: location, Err: err}
+	}
+
+	cloneOptions := ref.CloneOptions(parsed.Repository)
+	var repository *git.Repository
+	_, err = options.GitAuthenticator.withChallenge(options.catalog, parsed.Repository, auth, func(auth transport.AuthMethod) (err error) {
+		cloneOptions.Auth = auth
+		repository, err = git.CloneContext(ctx, memory.NewStorage(), nil, cloneOptions)
+		return err
+	})
+	if err != nil {
+		return nil, &ManifestNetworkError{Location: location, Err: err}
+	}
+
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+	hash := head.Hash()
+	if ref.Commit != "" {
+		resolved, err := repository.ResolveRevision(plumbing.Revision(ref.Commit))
+		if err != nil {
+			return nil, fmt.Errorf("unable to find commit %v in %v: %w", ref.Commit, parsed.Repository, err)
+		}
+		hash = *resolved
+	}
+
+	commit, err := repository.CommitObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(parsed.Path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %v from %v at %v: %w", parsed.Path, parsed.Repository, ref, err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return &manifestResponse{Body: []byte(contents)}, nil
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseGitManifestLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     gitManifestLocation
+		wantErr  bool
+	}{
+		{"git+ssh://git@github.com/org/repo.git#main:path/to/scaffolds.yml", gitManifestLocation{"ssh://git@github.com/org/repo.git", "main", "path/to/scaffolds.yml"}, false},
+		{"git+https://github.com/org/repo.git#:scaffolds.yml", gitManifestLocation{"https://github.com/org/repo.git", "", "scaffolds.yml"}, false},
+		{"git+file:///srv/repo#/scaffolds.yml", gitManifestLocation{"file:///srv/repo", "", "scaffolds.yml"}, false},
+		{"git+ssh://git@github.com/org/repo.git", gitManifestLocation{}, true},
+		{"git+ssh://git@github.com/org/repo.git#main:", gitManifestLocation{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseGitManifestLocation(tt.location)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseGitManifestLocation(%q) error = %v, wantErr %v", tt.location, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseGitManifestLocation(%q) got = %v, want %v", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestReadGitManifest(t *testing.T) {
+	v2Manifest := strings.Replace(cacheTestManifest, "cached", "v2", 1)
+	repoDir, hashes := newTestRepository(t, []map[string]string{
+		{"catalog/scaffolds.yml": cacheTestManifest},
+		{"catalog/scaffolds.yml": v2Manifest},
+	}, map[int]string{0: "v1.0.0"})
+
+	tests := []struct {
+		ref  string
+		want string
+	}{
+		{"", v2Manifest},
+		{"v1.0.0", cacheTestManifest},
+		{hashes[0].String()[:10], cacheTestManifest},
+	}
+	for _, tt := range tests {
+		location := "git+file://" + repoDir + "#" + tt.ref + ":catalog/scaffolds.yml"
+		got, err := ReadManifest(location, ManifestOptions{})
+		if err != nil {
+			t.Errorf("ReadManifest(%q) error = %v", location, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("ReadManifest(%q) got = %v, want %v", location, string(got), tt.want)
+		}
+	}
+
+	if _, err := ReadManifest("git+file://"+repoDir+"#missing.yml", ManifestOptions{}); err == nil {
+		t.Errorf("ReadManifest() of a missing file expected an error")
+	}
+}
+
+func TestReadStdinManifest(t *testing.T) {
+	stdin := manifestStdin
+	manifestStdin = strings.NewReader(cacheTestManifest)
+	defer func() { manifestStdin = stdin }()
+
+	scaffolds, err := GetScaffolds([]ManifestSource{NewManifestSource(StdinManifestLocation)}, ManifestOptions{})
+	if err != nil {
+		t.Fatalf("GetScaffolds() error = %v", err)
+	}
+	if scaffolds["cached"].Source != "stdin" {
+		t.Errorf("GetScaffolds() got = %v, want the `cached` scaffold from stdin", scaffolds)
+	}
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// hostkey.go verifies the host keys of ssh servers we clone from - against known_hosts files, a fingerprint
+// pinned in the manifest, or by asking the user to trust an unknown host. Unverified hosts are never accepted.
+
+// allHostKeyAlgorithms are offered when we don't know which key type a host will present. go-git would otherwise
+// fill in the algorithms from the default known_hosts, failing if there isn't one.
+var allHostKeyAlgorithms = []string{
+	ssh.KeyAlgoED25519, ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521,
+	ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA,
+}
+
+// knownHostsLock serialises trust-on-first-use prompts and writes to known_hosts
+var knownHostsLock sync.Mutex
+
+// DefaultKnownHostsFiles are those ssh itself uses - $SSH_KNOWN_HOSTS if set, or ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts
+func DefaultKnownHostsFiles() []string {
+	if files := filepath.SplitList(os.Getenv("SSH_KNOWN_HOSTS")); len(files) > 0 {
+		return files
+	}
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".ssh", "known_hosts"))
+	}
+	return append(files, "/etc/ssh/ssh_known_hosts")
+}
+
+// isValidHostKeyFingerprint checks a fingerprint looks like those printed by `ssh-keygen -lf`, e.g. SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU
+func isValidHostKeyFingerprint(fingerprint string) bool {
+	encoded, found := strings.CutPrefix(fingerprint, "SHA256:")
+	if !found {
+		return false
+	}
+	decoded, err := base64.RawStdEncoding.DecodeString(encoded)
+	return err == nil && len(decoded) == 32
+}
+
+// hostKeyAuth wraps an ssh auth method to use our own host key verification
+type hostKeyAuth struct {
+	gitssh.AuthMethod
+	callback   ssh.HostKeyCallback
+	algorithms []string
+}
+
+func newHostKeyAuth(auth gitssh.AuthMethod, callback ssh.HostKeyCallback, algorithms []string) *hostKeyAuth {
+	// go-git's auth methods fall back to reading the default known_hosts (and fail without one) unless given a callback
+	switch auth := auth.(type) {
+	case *gitssh.PublicKeys:
+		auth.HostKeyCallback = callback
+	case *gitssh.PublicKeysCallback:
+		auth.HostKeyCallback = callback
+	}
+	return &hostKeyAuth{AuthMethod: auth, callback: callback, algorithms: algorithms}
+}
+
+func (a *hostKeyAuth) ClientConfig() (*ssh.ClientConfig, error) {
+	config, err := a.AuthMethod.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.HostKeyCallback = a.callback
+	config.HostKeyAlgorithms = a.algorithms
+	return config, nil
+}
+
+// verifyHostKey wraps auth to verify hostWithPort's key against fingerprint, if given, or otherwise known_hosts
+func (a *GitAuthenticator) verifyHostKey(auth gitssh.AuthMethod, hostWithPort string, fingerprint string) (gitssh.AuthMethod, error) {
+	if fingerprint != "" {
+		if !isValidHostKeyFingerprint(fingerprint) {
+			return nil, fmt.Errorf("invalid host_key `%v` - it should be a SHA256 fingerprint, as printed by `ssh-keygen -lf`", fingerprint)
+		}
+		// offer every key type, as we can't tell which one was pinned
+		return newHostKeyAuth(auth, pinnedHostKeyCallback(fingerprint), allHostKeyAlgorithms), nil
+	}
+
+	files := a.KnownHosts
+	if len(files) == 0 {
+		files = DefaultKnownHostsFiles()
+	}
+	var existing []string
+	for _, file := range files {
+		if _, err := os.Stat(file); err == nil {
+			existing = append(existing, file)
+		}
+	}
+	db, err := knownhosts.NewDB(existing...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read known hosts: %w", err)
+	}
+	algorithms := db.HostKeyAlgorithms(hostWithPort)
+	if len(algorithms) == 0 {
+		algorithms = allHostKeyAlgorithms
+	}
+	return newHostKeyAuth(auth, a.knownHostsCallback(db, files[0]), algorithms), nil
+}
+
+func pinnedHostKeyCallback(fingerprint string) ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if actual := ssh.FingerprintSHA256(key); actual != fingerprint {
+			return fmt.Errorf("the host key for %v has fingerprint %v, but the scaffold's host_key is %v - "+
+				"someone could be intercepting the connection", hostname, actual, fingerprint)
+		}
+		return nil
+	}
+}
+
+// knownHostsCallback accepts hosts in db - unknown hosts can be trusted (and added to trustFile) with TrustHost,
+// but a host whose key has changed is always refused
+func (a *GitAuthenticator) knownHostsCallback(db *knownhosts.HostKeyDB, trustFile string) ssh.HostKeyCallback {
+	callback := db.HostKeyCallback()
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		fingerprint := ssh.FingerprintSHA256(key)
+		switch {
+		case err == nil:
+			return nil
+		case knownhosts.IsHostKeyChanged(err):
+			return fmt.Errorf("the host key for %v has changed (it's now %v %v) - someone could be intercepting the connection. "+
+				"If the change is expected, remove the old key from your known_hosts", hostname, key.Type(), fingerprint)
+		case !knownhosts.IsHostUnknown(err):
+			return err
+		case a.TrustHost == nil:
+			return fmt.Errorf("%v is not a known host - check its %v key fingerprint %v, then add it to %v (e.g. with `ssh-keyscan`), "+
+				"or pin it with host_key in the manifest", hostname, key.Type(), fingerprint, trustFile)
+		}
+
+		knownHostsLock.Lock()
+		defer knownHostsLock.Unlock()
+		// another fetch may have trusted the host while we waited
+		if trusted, err := knownhosts.NewDB(trustFile); err == nil && trusted.HostKeyCallback()(hostname, remote, key) == nil {
+			return nil
+		}
+		ok, err := a.TrustHost(hostname, key)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("the host key for %v was not trusted", hostname)
+		}
+		return appendKnownHost(trustFile, hostname, remote, key)
+	}
+}
+
+func appendKnownHost(file string, hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err = knownhosts.WriteKnownHost(f, hostname, remote, key); err != nil {
+		return fmt.Errorf("unable to add %v to %v: %w", hostname, file, err)
+	}
+	return nil
+}
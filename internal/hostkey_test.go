@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/skeema/knownhosts"
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestIsValidHostKeyFingerprint(t *testing.T) {
+	tests := map[string]bool{
+		"SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU":  true,
+		"SHA256:+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOq":   false,
+		"+DiY3wvvV6TuJJhbpZisF/zLDA0zPMSvHdkr4UvCOqU":         false,
+		"MD5:16:27:ac:a5:76:28:2d:36:63:1b:56:4d:eb:df:a6:48": false,
+	}
+	for fingerprint, want := range tests {
+		if got := isValidHostKeyFingerprint(fingerprint); got != want {
+			t.Errorf("isValidHostKeyFingerprint(%v) got = %v, want %v", fingerprint, got, want)
+		}
+	}
+}
+
+func TestVerifyHostKey(t *testing.T) {
+	keyAuth, err := (&GitAuthenticator{}).sshKeyAuth("git", writeTestKey(t, ""), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	knownKey, otherKey := newTestHostKey(t), newTestHostKey(t)
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{"known.example.com"}, knownKey)+"\n"), 0600)
+	remote := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 22}
+
+	callback := func(t *testing.T, authenticator *GitAuthenticator, host string, fingerprint string) ssh.HostKeyCallback {
+		t.Helper()
+		auth, err := authenticator.verifyHostKey(keyAuth, host+":22", fingerprint)
+		if err != nil {
+			t.Fatalf("verifyHostKey() error = %v", err)
+		}
+		config, err := auth.ClientConfig()
+		if err != nil {
+			t.Fatalf("ClientConfig() error = %v", err)
+		}
+		if host == "known.example.com" && fingerprint == "" && !slices.Equal(config.HostKeyAlgorithms, []string{ssh.KeyAlgoED25519}) {
+			t.Errorf("ClientConfig() got host key algorithms %v, want just %v", config.HostKeyAlgorithms, ssh.KeyAlgoED25519)
+		}
+		return config.HostKeyCallback
+	}
+
+	t.Run("known hosts", func(t *testing.T) {
+		verify := callback(t, &GitAuthenticator{KnownHosts: []string{knownHosts}}, "known.example.com", "")
+		if err := verify("known.example.com:22", remote, knownKey); err != nil {
+			t.Errorf("known host key error = %v", err)
+		}
+		err := verify("known.example.com:22", remote, otherKey)
+		if err == nil || !strings.Contains(err.Error(), "has changed") {
+			t.Errorf("changed host key error = %v, want it to have changed", err)
+		}
+		if err := callback(t, &GitAuthenticator{KnownHosts: []string{knownHosts}}, "unknown.example.com", "")("unknown.example.com:22", remote, otherKey); err == nil {
+			t.Errorf("unknown host without TrustHost should be refused")
+		}
+	})
+
+	t.Run("trust on first use", func(t *testing.T) {
+		trustFile := filepath.Join(t.TempDir(), "ssh", "known_hosts")
+		asked := 0
+		authenticator := &GitAuthenticator{KnownHosts: []string{trustFile, knownHosts}, TrustHost: func(hostname string, key ssh.PublicKey) (bool, error) {
+			asked++
+			return hostname == "trusted.example.com:22", nil
+		}}
+		if err := callback(t, authenticator, "refused.example.com", "")("refused.example.com:22", remote, otherKey); err == nil {
+			t.Errorf("untrusted host should be refused")
+		}
+		if err := callback(t, authenticator, "trusted.example.com", "")("trusted.example.com:22", remote, otherKey); err != nil {
+			t.Errorf("trusted host error = %v", err)
+		}
+		// once trusted, the host is known
+		if err := callback(t, &GitAuthenticator{KnownHosts: []string{trustFile}}, "trusted.example.com", "")("trusted.example.com:22", remote, otherKey); err != nil {
+			t.Errorf("previously trusted host error = %v", err)
+		}
+		// but a changed key is never offered for trust
+		if err := callback(t, authenticator, "known.example.com", "")("known.example.com:22", remote, otherKey); err == nil {
+			t.Errorf("changed host key should be refused")
+		}
+		if asked != 2 {
+			t.Errorf("TrustHost was asked %d times, want 2", asked)
+		}
+	})
+
+	t.Run("pinned fingerprint", func(t *testing.T) {
+		verify := callback(t, &GitAuthenticator{KnownHosts: []string{knownHosts}}, "pinned.example.com", ssh.FingerprintSHA256(otherKey))
+		if err := verify("pinned.example.com:22", remote, otherKey); err != nil {
+			t.Errorf("pinned host key error = %v", err)
+		}
+		if err := verify("pinned.example.com:22", remote, knownKey); err == nil {
+			t.Errorf("host key not matching the pinned fingerprint should be refused")
+		}
+		if _, err := (&GitAuthenticator{}).verifyHostKey(keyAuth, "pinned.example.com:22", "not a fingerprint"); err == nil {
+			t.Errorf("verifyHostKey() with an invalid fingerprint should fail")
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"golang.org/x/net/http/httpproxy"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// httpclient.go builds the http client shared by everything that talks http - manifests, archives and git -
+// so that proxies and custom CAs (e.g. behind a corporate MITM proxy) are honoured consistently.
+
+type HTTPClientOptions struct {
+	// CAFile is a PEM bundle of extra certificate authorities to trust, on top of the system's
+	CAFile string
+	// Proxy overrides the HTTPS_PROXY/HTTP_PROXY environment variables. NO_PROXY is honoured either way.
+	Proxy string
+}
+
+// NewHTTPClient returns a client using the configured CAs and proxy
+func NewHTTPClient(options HTTPClientOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+
+	if options.Proxy != "" {
+		if _, err := url.Parse(options.Proxy); err != nil {
+			return nil, fmt.Errorf("invalid proxy %v: %w", RedactUrl(options.Proxy), err)
+		}
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  options.Proxy,
+			HTTPSProxy: options.Proxy,
+			NoProxy:    noProxyFromEnvironment(),
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if options.CAFile != "" {
+		pem, err := os.ReadFile(options.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in CA file " + options.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+func noProxyFromEnvironment() string {
+	if noProxy := os.Getenv("NO_PROXY"); noProxy != "" {
+		return noProxy
+	}
+	return os.Getenv("no_proxy")
+}
+
+// InstallGitHTTPClient makes go-git use httpClient for all http(s) clones and fetches
+func InstallGitHTTPClient(httpClient *http.Client) {
+	transport := githttp.NewClient(httpClient)
+	client.InstallProtocol("https", transport)
+	client.InstallProtocol("http", transport)
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewHTTPClientCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cacheTestManifest))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certificate, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	source := ManifestSource{Name: "tls", Location: server.URL + "/scaffolds.yml"}
+	if _, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{}); err == nil {
+		t.Errorf("GetScaffolds() without the CA should fail")
+	}
+
+	client, err := NewHTTPClient(HTTPClientOptions{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+	scaffolds, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{HTTPClient: client})
+	if err != nil {
+		t.Fatalf("GetScaffolds() with the CA error = %v", err)
+	}
+	if _, ok := scaffolds["cached"]; !ok {
+		t.Errorf("GetScaffolds() got %v, want the `cached` scaffold", scaffolds)
+	}
+
+	if _, err := NewHTTPClient(HTTPClientOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Errorf("NewHTTPClient() with a missing CA file should fail")
+	}
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	os.WriteFile(empty, []byte("not a certificate"), 0644)
+	if _, err := NewHTTPClient(HTTPClientOptions{CAFile: empty}); err == nil {
+		t.Errorf("NewHTTPClient() with no certificates in the CA file should fail")
+	}
+}
+
+func TestNewHTTPClientProxy(t *testing.T) {
+	// The proxy answers for any host, so requests to .invalid hosts only succeed if they were proxied
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "manifests.invalid" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(cacheTestManifest))
+	}))
+	defer proxy.Close()
+
+	t.Setenv("NO_PROXY", "excluded.invalid")
+	client, err := NewHTTPClient(HTTPClientOptions{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewHTTPClient() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		location string
+		wantErr  bool
+	}{
+		{"proxied", "http://manifests.invalid/scaffolds.yml", false},
+		{"excluded by NO_PROXY", "http://excluded.invalid/scaffolds.yml", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := ManifestSource{Name: "proxy", Location: tt.location}
+			_, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{HTTPClient: client})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetScaffolds() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
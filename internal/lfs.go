@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// lfs.go deals with Git LFS, which go-git doesn't support - scaffolds opting in with `lfs: true` have their
+// LFS files fetched by git-lfs, if it's installed, and we warn about any LFS pointers left behind.
+
+var lfsPointerPrefix = []byte("version https://git-lfs.github.com/spec/v1")
+
+// lfsPointerMaxSize is the largest a pointer file can be, according to the spec
+const lfsPointerMaxSize = 1024
+
+// pullLFS replaces the LFS pointers in a fresh clone with their contents, fetched from remoteUrl
+func pullLFS(ctx context.Context, repository *git.Repository, dir string, remoteUrl string) error {
+	if err := exec.Command("git", "lfs", "version").Run(); err != nil {
+		return fmt.Errorf("git-lfs isn't installed")
+	}
+	// the clone's origin may be our mirror, which doesn't hold LFS objects
+	config, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	if origin, ok := config.Remotes["origin"]; ok {
+		origin.URLs = []string{remoteUrl}
+		if err = repository.SetConfig(config); err != nil {
+			return err
+		}
+	}
+	cmd := exec.CommandContext(ctx, "git", "lfs", "pull")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("git lfs pull failed: %w: %s", err, bytes.TrimSpace(output.Bytes()))
+	}
+	return nil
+}
+
+// findLFSPointers returns the paths, relative to dir, of any files that are still LFS pointers
+func findLFSPointers(dir string) ([]string, error) {
+	var pointers []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || !isLFSPointer(path) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		pointers = append(pointers, filepath.ToSlash(rel))
+		return nil
+	})
+	return pointers, err
+}
+
+func isLFSPointer(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > lfsPointerMaxSize {
+		return false
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(lfsPointerPrefix))
+	if _, err = io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, lfsPointerPrefix)
+}
@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testLFSPointer = `version https://git-lfs.github.com/spec/v1
+oid sha256:4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+size 12345
+`
+
+func TestFindLFSPointers(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "web", "images"), 0755)
+	os.WriteFile(filepath.Join(dir, "web", "images", "favicon.ico"), []byte(testLFSPointer), 0644)
+	os.WriteFile(filepath.Join(dir, "README.md"), []byte("# readme"), 0644)
+	os.WriteFile(filepath.Join(dir, "large.txt"), bytes.Repeat([]byte(testLFSPointer), 100), 0644)
+
+	pointers, err := findLFSPointers(dir)
+	if err != nil {
+		t.Fatalf("findLFSPointers() error = %v", err)
+	}
+	if !slices.Equal(pointers, []string{"web/images/favicon.ico"}) {
+		t.Errorf("findLFSPointers() got = %v, want just web/images/favicon.ico", pointers)
+	}
+}
+
+func TestGitSourceLFSWarnings(t *testing.T) {
+	scaffold, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []", "seed.sql.gz": testLFSPointer}}, nil)
+	lfsInstalled := exec.Command("git", "lfs", "version").Run() == nil
+
+	tests := []struct {
+		name string
+		repo ScaffoldRepo
+		want []string
+	}{
+		{"lfs not enabled", ScaffoldRepo{GitRepo: "file://" + scaffold}, []string{"1 files are unresolved Git LFS pointers", "set `lfs: true`"}},
+		{"lfs enabled", ScaffoldRepo{GitRepo: "file://" + scaffold, LFS: true}, []string{"1 files are unresolved Git LFS pointers"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var progress bytes.Buffer
+			source, err := NewSource(tt.repo, SourceOptions{Progress: &progress})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			if err = source.Fetch(t.TempDir()); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			want := tt.want
+			if tt.repo.LFS && !lfsInstalled {
+				want = append(want, "git-lfs isn't installed")
+			}
+			for _, message := range want {
+				if !strings.Contains(progress.String(), message) {
+					t.Errorf("Fetch() output %q doesn't contain %q", progress.String(), message)
+				}
+			}
+		})
+	}
+}
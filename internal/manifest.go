@@ -2,110 +2,307 @@ package internal
 
 import (
 	_ "embed"
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"strings"
 )
 
 const manifestUrl = "https://raw.githubusercontent.com/uselagoon/lagoon-scaffold/main/internal/assets/scaffolds.yml"
 
+// ManifestSchemaVersion is the newest manifest `version` we understand
+const ManifestSchemaVersion = 1
+
+// DefaultSourceName is the name given to the public Lagoon scaffold manifest
+const DefaultSourceName = "lagoon"
+
 //go:embed assets/scaffolds.yml
 var defaultScaffolds []byte
 
-func getManifestFromUrl(manifestUrl string) ([]byte, error) {
-	resp, err := http.Get(manifestUrl)
+// ManifestSource is a single location that scaffold definitions are loaded from.
+// Sources are layered in order, with scaffolds in later sources replacing
+// scaffolds of the same name in earlier ones.
+type ManifestSource struct {
+	Name     string
+	Location string // a local file path, an http(s) url, a git+ url or "-" for stdin
+	// UseEmbeddedFallback will return the manifest embedded at build time if Location can't be loaded
+	UseEmbeddedFallback bool
+	// PublicKeys are the minisign keys trusted to sign this manifest - if any are given the manifest must be signed
+	PublicKeys []string
+	// Credentials are used to fetch the manifest from an authenticated endpoint
+	Credentials ManifestCredentials
+}
+
+// DefaultManifestSource returns the public Lagoon scaffold manifest
+func DefaultManifestSource() ManifestSource {
+	return ManifestSource{
+		Name:                DefaultSourceName,
+		Location:            manifestUrl,
+		UseEmbeddedFallback: true,
+		PublicKeys:          DefaultTrustedKeys(),
+	}
+}
+
+// NewManifestSource returns a source for a local path, url, git manifest or stdin, named after its location
+func NewManifestSource(location string) ManifestSource {
+	name := location
+	if location == StdinManifestLocation {
+		name = "stdin"
+	}
+	return ManifestSource{
+		Name:     name,
+		Location: location,
+	}
+}
+
+func isRemoteLocation(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// ManifestNetworkError is returned when a manifest server can't be reached at all
+type ManifestNetworkError struct {
+	Location string
+	Err      error
+}
+
+func (e *ManifestNetworkError) Error() string {
+	return fmt.Sprintf("unable to fetch manifest %v: %v", e.Location, e.Err)
+}
+
+func (e *ManifestNetworkError) Unwrap() error {
+	return e.Err
+}
+
+// ManifestStatusError is returned when a manifest server responds with anything other than success
+type ManifestStatusError struct {
+	Location   string
+	StatusCode int
+	Status     string
+}
+
+func (e *ManifestStatusError) Error() string {
+	return fmt.Sprintf("unable to fetch manifest %v: server responded with %v", e.Location, e.Status)
+}
+
+// ManifestParseError is returned when a manifest isn't valid
+type ManifestParseError struct {
+	Location string
+	Err      error
+}
+
+func (e *ManifestParseError) Error() string {
+	return fmt.Sprintf("unable to parse manifest %v: %v", e.Location, e.Err)
+}
+
+func (e *ManifestParseError) Unwrap() error {
+	return e.Err
+}
+
+type manifestResponse struct {
+	Body         []byte
+	ETag         string
+	LastModified string
+	NotModified  bool
+}
+
+// getManifestFromUrl fetches a manifest, making the request conditional if we have an etag or last modified date
+func getManifestFromUrl(manifestUrl string, etag string, lastModified string, options ManifestOptions) (*manifestResponse, error) {
+	ctx, cancel := options.requestContext()
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, manifestUrl, nil)
 	if err != nil {
-		return nil, err
+		return nil, redactError(err, manifestUrl, nil)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+	secrets := options.credentials.apply(req)
+
+	resp, err := options.httpClient().Do(req)
+	if err != nil {
+		return nil, &ManifestNetworkError{Location: RedactUrl(manifestUrl), Err: redactError(err, manifestUrl, secrets)}
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return &manifestResponse{NotModified: true}, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &ManifestStatusError{Location: RedactUrl(manifestUrl), StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, &ManifestNetworkError{Location: RedactUrl(manifestUrl), Err: redactError(err, manifestUrl, secrets)}
 	}
 
-	return body, nil
+	return &manifestResponse{
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
 }
 
 func getDefaultScaffold() (map[string]ScaffoldRepo, error) {
+	return parseManifest("(embedded)", defaultScaffolds)
+}
+
+func parseManifest(location string, data []byte) (map[string]ScaffoldRepo, error) {
 	loader := &ScaffoldLoader{
 		Scaffolds: make([]ScaffoldRepo, 0),
 	}
-	err := yaml.Unmarshal(defaultScaffolds, loader)
+	err := yaml.UnmarshalStrict(data, loader)
 
 	if err != nil {
-		return nil, err
+		return nil, &ManifestParseError{Location: location, Err: err}
 	}
 
-	return remapScaffoldLoader(loader), nil
-}
-
-func resolveScaffolds(manifestUrl string) map[string]ScaffoldRepo {
+	if loader.Version > ManifestSchemaVersion {
+		return nil, &ManifestParseError{Location: location, Err: fmt.Errorf("manifest version %v is not supported by this version of lagoon-scaffold (supports up to %v) - please upgrade", loader.Version, ManifestSchemaVersion)}
+	}
 
-	defaultScaffold, err := getDefaultScaffold()
+	scaffolds, err := remapScaffoldLoader(loader)
 	if err != nil {
-		panic(err)
+		return nil, &ManifestParseError{Location: location, Err: err}
 	}
+	return scaffolds, nil
+}
 
-	if manifestUrl == "" {
-		return defaultScaffold
-	}
+// resolveScaffolds loads a remote manifest, falling back to the embedded manifest (with a warning) if it can't be,
+// unless options.Strict is set. Signature failures are never recovered from.
+func resolveScaffolds(source ManifestSource, options ManifestOptions) (map[string]ScaffoldRepo, error) {
 
-	scaffolds, err := getManifestFromUrl(manifestUrl)
+	defaultScaffold, err := getDefaultScaffold()
 	if err != nil {
-		return defaultScaffold
+		return nil, err
 	}
 
-	loader := &ScaffoldLoader{
-		Scaffolds: make([]ScaffoldRepo, 0),
+	if source.Location == "" {
+		return defaultScaffold, nil
 	}
-	err = yaml.Unmarshal(scaffolds, loader)
 
-	if err != nil {
-		return defaultScaffold
+	dat, err := readVerifiedManifest(source, options)
+	if err == nil {
+		var scaffolds map[string]ScaffoldRepo
+		scaffolds, err = parseManifest(source.Location, dat)
+		if err == nil {
+			return scaffolds, nil
+		}
 	}
 
-	return remapScaffoldLoader(loader)
+	var signatureErr *SignatureError
+	if options.Strict || errors.As(err, &signatureErr) {
+		return nil, err
+	}
+	options.warn("%v - using the manifest embedded at build time, which may be out of date", err)
+	return defaultScaffold, nil
 }
 
-func remapScaffoldLoader(loader *ScaffoldLoader) map[string]ScaffoldRepo {
+func remapScaffoldLoader(loader *ScaffoldLoader) (map[string]ScaffoldRepo, error) {
 	remapped := make(map[string]ScaffoldRepo)
 	for _, scaffold := range loader.Scaffolds {
+		if _, exists := remapped[scaffold.Name]; exists {
+			return nil, fmt.Errorf("scaffold `%v` is defined more than once", scaffold.Name)
+		}
 		remapped[scaffold.Name] = scaffold
 	}
-	return remapped
+	return remapped, nil
 }
 
-func GetScaffolds(localmanifest string) (map[string]ScaffoldRepo, error) {
+// ReadManifest reads a manifest, or its signature, from a url, git repository, local path or stdin
+func ReadManifest(location string, options ManifestOptions) ([]byte, error) {
+	if location == StdinManifestLocation {
+		return ioutil.ReadAll(manifestStdin)
+	}
+	if isRemoteLocation(location) || isGitManifestLocation(location) {
+		return fetchManifest(location, options)
+	}
+	return os.ReadFile(location)
+}
 
-	if localmanifest != "" { // we try load up a manifest given locally
-		// try open and read the file
+func loadManifestSource(source ManifestSource, options ManifestOptions) (map[string]ScaffoldRepo, error) {
+	if source.UseEmbeddedFallback {
+		return resolveScaffolds(source, options)
+	}
 
-		loader := &ScaffoldLoader{
-			Scaffolds: make([]ScaffoldRepo, 0),
-		}
-		dat, err := os.ReadFile(localmanifest)
-		err = yaml.Unmarshal(dat, loader)
-		if err != nil {
-			return map[string]ScaffoldRepo{}, err
-		}
+	dat, err := readVerifiedManifest(source, options)
+	if err != nil {
+		return nil, err
+	}
 
-		return remapScaffoldLoader(loader), nil
+	return parseManifest(source.Location, dat)
+}
 
+// GetScaffolds loads every source in order and merges the scaffolds they define by name.
+// Where two sources define a scaffold with the same name, the later source wins and
+// the scaffold it replaces remains available as `source/name`.
+func GetScaffolds(sources []ManifestSource, options ManifestOptions) (map[string]ScaffoldRepo, error) {
+	merged := make(map[string]ScaffoldRepo)
+	for _, source := range sources {
+		scaffolds, err := loadManifestSource(source, options)
+		if err != nil {
+			return map[string]ScaffoldRepo{}, fmt.Errorf("unable to load manifest `%v`: %w", source.Name, err)
+		}
+		for name, scaffold := range scaffolds {
+			scaffold.Source = source.Name
+			if shadowed, exists := merged[name]; exists {
+				merged[shadowed.QualifiedName()] = shadowed
+			}
+			merged[name] = scaffold
+		}
 	}
+	return merged, nil
+}
 
-	return resolveScaffolds(manifestUrl), nil
+// FindScaffold looks up a scaffold either by its name or as `source/name`
+func FindScaffold(scaffolds map[string]ScaffoldRepo, key string) (ScaffoldRepo, bool) {
+	if scaffold, ok := scaffolds[key]; ok {
+		return scaffold, true
+	}
+	sep := strings.LastIndex(key, "/")
+	if sep == -1 {
+		return ScaffoldRepo{}, false
+	}
+	scaffold, ok := scaffolds[key[sep+1:]]
+	if ok && scaffold.Source == key[:sep] {
+		return scaffold, true
+	}
+	return ScaffoldRepo{}, false
 }
 
 type ScaffoldRepo struct {
 	Name             string `yaml:"name,omitempty"`
 	GitRepo          string `yaml:"git_repo,omitempty"`
+	Path             string `yaml:"path,omitempty"`    // a local directory used in place of a git repository
+	Archive          string `yaml:"archive,omitempty"` // a .tar.gz or .zip url or path used in place of a git repository
+	SHA256           string `yaml:"sha256,omitempty"`  // the required checksum of Archive
+	Subdir           string `yaml:"subdir,omitempty"`  // the directory within the repository, path or archive holding the scaffold
 	Branch           string `yaml:"branch,omitempty"`
+	Tag              string `yaml:"tag,omitempty"`
+	Commit           string `yaml:"commit,omitempty"`
+	Version          string `yaml:"version,omitempty"`    // a semver constraint resolved against the repository's tags
+	HostKey          string `yaml:"host_key,omitempty"`   // the SHA256 fingerprint of the ssh server's host key, in place of known_hosts
+	Submodules       bool   `yaml:"submodules,omitempty"` // fetch the repository's submodules, recursively
+	LFS              bool   `yaml:"lfs,omitempty"`        // fetch Git LFS files, using git-lfs
 	Description      string `yaml:"description,omitempty"`
 	ShortDescription string `yaml:"shortDescription,omitempty"`
+	Source           string `yaml:"-"` // the name of the manifest source this scaffold was loaded from
+}
+
+// QualifiedName returns the scaffold's name prefixed with the source it came from
+func (s ScaffoldRepo) QualifiedName() string {
+	return s.Source + "/" + s.Name
 }
 
 type ScaffoldLoader struct {
+	// Version is the manifest schema version - manifests without one are treated as version 1
+	Version   int            `yaml:"version,omitempty"`
 	Scaffolds []ScaffoldRepo `yaml:"scaffolds,omitempty"`
 }
@@ -1,7 +1,12 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -28,6 +33,20 @@ func Test_resolveScaffolds(t *testing.T) {
 					ShortDescription: "Pulls and sets up a new Lagoon ready Drupal 9",
 					Description:      "Pulls and sets up a new Lagoon ready Drupal 9",
 				},
+				"rails-init": {
+					Name:             "rails-init",
+					GitRepo:          "https://github.com/CGoodwin90/lagoon-rails-dir.git",
+					Branch:           "main",
+					ShortDescription: "Will add a minimal set of files to an existing Rails 7 installation",
+					Description:      "Will add a minimal set of files to an existing Rails 7 installation",
+				},
+				"php-init": {
+					Name:             "php-init",
+					GitRepo:          "https://github.com/bomoko/php-example-simple.git",
+					Branch:           "main",
+					ShortDescription: "Will add a minimal set of lagoon files to an existing PHP 8 installation",
+					Description:      "Will add a minimal set of lagoon files to an existing PHP 8 installation",
+				},
 			},
 		},
 	}
@@ -47,7 +66,7 @@ func Test_resolveScaffolds(t *testing.T) {
 
 func TestGetScaffolds(t *testing.T) {
 	type args struct {
-		localmanifest string
+		sources []ManifestSource
 	}
 	tests := []struct {
 		name    string
@@ -58,7 +77,7 @@ func TestGetScaffolds(t *testing.T) {
 		{
 			name: "Test 1 - Passing manifest file manually",
 			args: args{
-				localmanifest: "./testassets/manifest_test_1.yml",
+				sources: []ManifestSource{NewManifestSource("./testassets/manifest_test_1.yml")},
 			},
 			want: map[string]ScaffoldRepo{
 				"test1": {
@@ -67,13 +86,57 @@ func TestGetScaffolds(t *testing.T) {
 					Branch:           "test1_branch",
 					Description:      "test1_description",
 					ShortDescription: "test1_shortDescription",
+					Source:           "./testassets/manifest_test_1.yml",
 				},
 			},
 		},
+		{
+			name: "Test 2 - Later manifests override earlier ones by name",
+			args: args{
+				sources: []ManifestSource{
+					{Name: "base", Location: "./testassets/manifest_test_1.yml"},
+					{Name: "override", Location: "./testassets/manifest_test_2.yml"},
+				},
+			},
+			want: map[string]ScaffoldRepo{
+				"test1": {
+					Name:             "test1",
+					GitRepo:          "https://github.com/example/test1-override.git",
+					Branch:           "override_branch",
+					Description:      "test1_override_description",
+					ShortDescription: "test1_override_shortDescription",
+					Source:           "override",
+				},
+				"base/test1": {
+					Name:             "test1",
+					GitRepo:          "https://github.com/lagoon-examples/test1.git",
+					Branch:           "test1_branch",
+					Description:      "test1_description",
+					ShortDescription: "test1_shortDescription",
+					Source:           "base",
+				},
+				"test2": {
+					Name:             "test2",
+					GitRepo:          "https://github.com/example/test2.git",
+					Branch:           "main",
+					Description:      "test2_description",
+					ShortDescription: "test2_shortDescription",
+					Source:           "override",
+				},
+			},
+		},
+		{
+			name: "Test 3 - Missing manifest file",
+			args: args{
+				sources: []ManifestSource{NewManifestSource("./testassets/does_not_exist.yml")},
+			},
+			want:    map[string]ScaffoldRepo{},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetScaffolds(tt.args.localmanifest)
+			got, err := GetScaffolds(tt.args.sources, ManifestOptions{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetScaffolds() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -84,3 +147,89 @@ func TestGetScaffolds(t *testing.T) {
 		})
 	}
 }
+
+func TestFindScaffold(t *testing.T) {
+	scaffolds, err := GetScaffolds([]ManifestSource{
+		{Name: "base", Location: "./testassets/manifest_test_1.yml"},
+		{Name: "override", Location: "./testassets/manifest_test_2.yml"},
+	}, ManifestOptions{})
+	if err != nil {
+		t.Fatalf("GetScaffolds() error = %v", err)
+	}
+	tests := []struct {
+		key        string
+		wantFound  bool
+		wantSource string
+	}{
+		{"test1", true, "override"},
+		{"override/test1", true, "override"},
+		{"base/test1", true, "base"},
+		{"base/test2", false, ""},
+		{"missing", false, ""},
+	}
+	for _, tt := range tests {
+		got, found := FindScaffold(scaffolds, tt.key)
+		if found != tt.wantFound {
+			t.Errorf("FindScaffold(%q) found = %v, want %v", tt.key, found, tt.wantFound)
+			continue
+		}
+		if found && got.Source != tt.wantSource {
+			t.Errorf("FindScaffold(%q) source = %v, want %v", tt.key, got.Source, tt.wantSource)
+		}
+	}
+}
+
+func TestResolveScaffoldsFallback(t *testing.T) {
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/invalid.yml" {
+			w.Write([]byte("scaffolds: [[["))
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	tests := []struct {
+		name     string
+		location string
+		checkErr func(error) bool
+	}{
+		{"non-2xx status", broken.URL + "/scaffolds.yml", func(err error) bool {
+			var statusErr *ManifestStatusError
+			return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusInternalServerError
+		}},
+		{"invalid yaml", broken.URL + "/invalid.yml", func(err error) bool {
+			var parseErr *ManifestParseError
+			return errors.As(err, &parseErr)
+		}},
+		{"unreachable", unreachable.URL + "/scaffolds.yml", func(err error) bool {
+			var networkErr *ManifestNetworkError
+			return errors.As(err, &networkErr)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := DefaultManifestSource()
+			source.Location = tt.location
+
+			var warnings bytes.Buffer
+			got, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Warnings: &warnings})
+			if err != nil {
+				t.Fatalf("GetScaffolds() error = %v", err)
+			}
+			if _, ok := got["drupal-9"]; !ok {
+				t.Errorf("GetScaffolds() should fall back to the embedded manifest, got %v", got)
+			}
+			if !strings.Contains(warnings.String(), "embedded") {
+				t.Errorf("GetScaffolds() should warn when falling back, got %q", warnings.String())
+			}
+
+			_, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{Strict: true})
+			if !tt.checkErr(err) {
+				t.Errorf("GetScaffolds() strict error = %v (%T)", err, errors.Unwrap(err))
+			}
+		})
+	}
+}
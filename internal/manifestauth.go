@@ -0,0 +1,103 @@
+package internal
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// manifestauth.go deals with manifests behind authenticated endpoints, making sure
+// the credentials involved never end up in anything we print.
+
+const redacted = "[REDACTED]"
+
+// ManifestCredentials are applied to every request for a manifest (and its signature).
+// ${VAR} references to environment variables in the token and header values are expanded,
+// so that secrets needn't be written into the config file.
+type ManifestCredentials struct {
+	// Token is sent as a bearer token
+	Token   string            `yaml:"token,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Netrc uses the login and password for the manifest's host in ~/.netrc (or $NETRC)
+	Netrc bool `yaml:"netrc,omitempty"`
+}
+
+func (c ManifestCredentials) empty() bool {
+	return c.Token == "" && len(c.Headers) == 0 && !c.Netrc
+}
+
+// apply adds the credentials to req, returning the secrets involved so they can be redacted
+func (c ManifestCredentials) apply(req *http.Request) []string {
+	var secrets []string
+	if c.Netrc {
+		if login, password, ok := netrcCredentials(req.URL.Hostname()); ok {
+			req.SetBasicAuth(login, password)
+			secrets = append(secrets, password)
+		}
+	}
+	for name, value := range c.Headers {
+		value = os.ExpandEnv(value)
+		req.Header.Set(name, value)
+		secrets = append(secrets, value)
+	}
+	if c.Token != "" {
+		token := os.ExpandEnv(c.Token)
+		req.Header.Set("Authorization", "Bearer "+token)
+		secrets = append(secrets, token)
+	}
+	return secrets
+}
+
+// RedactUrl strips any password from a url, along with the values of its query parameters, which often hold tokens
+func RedactUrl(location string) string {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Host == "" {
+		return location
+	}
+	query := parsed.Query()
+	for key := range query {
+		query.Set(key, "REDACTED")
+	}
+	parsed.RawQuery = strings.ReplaceAll(query.Encode(), "REDACTED", redacted)
+	return parsed.Redacted()
+}
+
+// redactedError hides secrets that may have found their way into an error message
+type redactedError struct {
+	err     error
+	secrets []string
+}
+
+func (e *redactedError) Error() string {
+	message := e.err.Error()
+	for _, secret := range e.secrets {
+		if len(secret) > 0 {
+			message = strings.ReplaceAll(message, secret, redacted)
+		}
+	}
+	return message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError wraps err so that none of secrets, nor any password or query values in location, appear in its message
+func redactError(err error, location string, secrets []string) error {
+	if err == nil {
+		return nil
+	}
+	if parsed, parseErr := url.Parse(location); parseErr == nil {
+		if password, ok := parsed.User.Password(); ok {
+			secrets = append(secrets, password)
+		}
+		for _, values := range parsed.Query() {
+			secrets = append(secrets, values...)
+		}
+	}
+	if len(secrets) == 0 {
+		return err
+	}
+	return &redactedError{err: err, secrets: secrets}
+}
@@ -0,0 +1,336 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gopkg.in/yaml.v2"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestcache.go keeps a copy of every remote manifest we've fetched, so that we can
+// revalidate them cheaply and fall back to the last manifest we saw when offline.
+
+const DefaultManifestTTL = time.Hour
+
+const DefaultManifestTimeout = 30 * time.Second
+
+type ManifestCache struct {
+	Dir string
+	// TTL is how long a cached manifest is used before it's revalidated with the server
+	TTL time.Duration
+}
+
+type manifestCacheMeta struct {
+	Url          string    `yaml:"url"`
+	ETag         string    `yaml:"etag,omitempty"`
+	LastModified string    `yaml:"last_modified,omitempty"`
+	FetchedAt    time.Time `yaml:"fetched_at"`
+}
+
+// ManifestOptions controls how remote manifests are fetched
+type ManifestOptions struct {
+	Cache *ManifestCache // nil disables caching
+	// Refresh revalidates cached manifests regardless of their TTL
+	Refresh bool
+	// Offline only uses cached (or embedded) manifests, and never touches the network
+	Offline bool
+	// Strict returns an error rather than falling back to a cached or embedded manifest
+	Strict bool
+	// GitAuth is used to fetch manifests from git repositories - if nil, GitAuthenticator decides
+	GitAuth          transport.AuthMethod
+	GitAuthenticator *GitAuthenticator
+	// Context, if set, cancels in-flight manifest requests when it's done
+	Context context.Context
+	// Timeout limits how long each manifest request can take - zero means DefaultManifestTimeout
+	Timeout time.Duration
+	// HTTPClient is used for manifest requests - nil means http.DefaultClient
+	HTTPClient *http.Client
+	// Rewriter, if set, rewrites manifest urls before they're fetched
+	Rewriter *URLRewriter
+	// credentials are those of the manifest source currently being read, and catalog its name
+	credentials ManifestCredentials
+	catalog     string
+	// Warnings receives a message whenever we fall back to a cached or embedded manifest - nil discards them
+	Warnings io.Writer
+}
+
+// requestContext returns a context for a single manifest request, bounded by the options' timeout
+func (o ManifestOptions) requestContext() (context.Context, context.CancelFunc) {
+	ctx := o.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DefaultManifestTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (o ManifestOptions) gitAuth(url string) (transport.AuthMethod, error) {
+	if o.GitAuth != nil || o.GitAuthenticator == nil {
+		return o.GitAuth, nil
+	}
+	return o.GitAuthenticator.Auth(o.catalog, url)
+}
+
+func (o ManifestOptions) httpClient() *http.Client {
+	if o.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return o.HTTPClient
+}
+
+func (o ManifestOptions) warn(format string, args ...interface{}) {
+	if o.Warnings != nil {
+		fmt.Fprintf(o.Warnings, "Warning: "+format+"\n", args...)
+	}
+}
+
+func NewManifestCache(dir string, ttl time.Duration) *ManifestCache {
+	return &ManifestCache{
+		Dir: filepath.Join(dir, "manifests"),
+		TTL: ttl,
+	}
+}
+
+func (c *ManifestCache) paths(url string) (string, string) {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, key+".yml"), filepath.Join(c.Dir, key+".meta.yml")
+}
+
+// Get returns the cached manifest for url, if any
+func (c *ManifestCache) Get(url string) ([]byte, *manifestCacheMeta, error) {
+	bodyPath, metaPath := c.paths(url)
+	rawMeta, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta := &manifestCacheMeta{}
+	if err = yaml.Unmarshal(rawMeta, meta); err != nil {
+		return nil, nil, err
+	}
+	body, err := os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return body, meta, nil
+}
+
+func (c *ManifestCache) Put(body []byte, meta *manifestCacheMeta) error {
+	// manifests may have been fetched with credentials, so are kept private
+	bodyPath, metaPath := c.paths(meta.Url)
+	if body != nil {
+		if err := writePrivateFile(bodyPath, body); err != nil {
+			return err
+		}
+	}
+	rawMeta, err := yaml.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return writePrivateFile(metaPath, rawMeta)
+}
+
+func (c *ManifestCache) isFresh(meta *manifestCacheMeta) bool {
+	return time.Since(meta.FetchedAt) < c.TTL
+}
+
+// getManifest fetches a manifest from either a git repository or a web server
+func getManifest(location string, etag string, lastModified string, options ManifestOptions) (*manifestResponse, error) {
+	if isGitManifestLocation(location) {
+		return getManifestFromGit(location, options)
+	}
+	return getManifestFromUrl(location, etag, lastModified, options)
+}
+
+// fetchManifest retrieves a remote manifest, preferring a fresh cached copy, then the server,
+// and finally a stale cached copy if the server can't be reached. Manifests are cached by the url
+// they're actually fetched from, once rewritten, so a copy fetched before the rewrites changed isn't used.
+func fetchManifest(url string, options ManifestOptions) ([]byte, error) {
+	url = rewriteManifestLocation(url, options.Rewriter)
+	cache := options.Cache
+	if cache == nil {
+		if options.Offline {
+			return nil, fmt.Errorf("cannot fetch %v while offline", url)
+		}
+		resp, err := getManifest(url, "", "", options)
+		if err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	cached, meta, cacheErr := cache.Get(url)
+	hasCache := cacheErr == nil
+
+	if options.Offline {
+		if !hasCache {
+			return nil, fmt.Errorf("manifest %v has not been cached and cannot be fetched while offline", url)
+		}
+		return cached, nil
+	}
+
+	if hasCache && !options.Refresh && cache.isFresh(meta) {
+		return cached, nil
+	}
+
+	etag, lastModified := "", ""
+	if hasCache {
+		etag, lastModified = meta.ETag, meta.LastModified
+	}
+	resp, err := getManifest(url, etag, lastModified, options)
+	if err != nil {
+		if hasCache && !options.Strict {
+			options.warn("%v - using the copy cached at %v", err, meta.FetchedAt.Format(time.RFC1123))
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	if resp.NotModified {
+		if !hasCache { // we never sent a conditional request, so this shouldn't happen
+			return nil, errors.New("unexpected 304 response for " + url)
+		}
+		meta.FetchedAt = time.Now()
+		_ = cache.Put(nil, meta)
+		return cached, nil
+	}
+
+	// failing to write the cache shouldn't stop us using the manifest we just fetched
+	_ = cache.Put(resp.Body, &manifestCacheMeta{
+		Url:          url,
+		ETag:         resp.ETag,
+		LastModified: resp.LastModified,
+		FetchedAt:    time.Now(),
+	})
+	return resp.Body, nil
+}
+
+func (c *ManifestCache) signaturePath(url string) string {
+	bodyPath, _ := c.paths(url)
+	return strings.TrimSuffix(bodyPath, ".yml") + signatureSuffixes[0]
+}
+
+// getSigned returns the cached manifest for url along with its cached signature, if both are cached
+func (c *ManifestCache) getSigned(url string) ([]byte, []byte, *manifestCacheMeta, error) {
+	body, meta, err := c.Get(url)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signature, err := os.ReadFile(c.signaturePath(url))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return body, signature, meta, nil
+}
+
+// putSigned caches a manifest together with its signature - body is nil when only the metadata has changed
+func (c *ManifestCache) putSigned(body []byte, signature []byte, meta *manifestCacheMeta) error {
+	if err := writePrivateFile(c.signaturePath(meta.Url), signature); err != nil {
+		return err
+	}
+	return c.Put(body, meta)
+}
+
+// fetchSignedManifest is fetchManifest for signed manifests. The manifest and its signature are cached,
+// revalidated and fallen back to as a pair, so that a stale manifest is never checked against a fresh
+// signature. Cached pairs are only used if they verify, and a freshly fetched pair that doesn't verify
+// is an error, never a reason to fall back.
+func fetchSignedManifest(url string, options ManifestOptions, verify func(manifest []byte, signature []byte) error) ([]byte, error) {
+	url = rewriteManifestLocation(url, options.Rewriter)
+	fetchPair := func(etag string, lastModified string) (*manifestResponse, []byte, error) {
+		resp, err := getManifest(url, etag, lastModified, options)
+		if err != nil {
+			return nil, nil, err
+		}
+		signature, err := readSignature(url, func(location string) ([]byte, error) {
+			signature, err := getManifest(location, "", "", options)
+			if err != nil {
+				return nil, err
+			}
+			return signature.Body, nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to read signature: %w", err)
+		}
+		return resp, signature, nil
+	}
+
+	cache := options.Cache
+	if cache == nil {
+		if options.Offline {
+			return nil, fmt.Errorf("cannot fetch %v while offline", url)
+		}
+		resp, signature, err := fetchPair("", "")
+		if err != nil {
+			return nil, err
+		}
+		if err = verify(resp.Body, signature); err != nil {
+			return nil, err
+		}
+		return resp.Body, nil
+	}
+
+	cached, cachedSignature, meta, cacheErr := cache.getSigned(url)
+	hasCache := cacheErr == nil && verify(cached, cachedSignature) == nil
+
+	if options.Offline {
+		if !hasCache {
+			return nil, fmt.Errorf("signed manifest %v has not been cached and cannot be fetched while offline", url)
+		}
+		return cached, nil
+	}
+
+	if hasCache && !options.Refresh && cache.isFresh(meta) {
+		return cached, nil
+	}
+
+	etag, lastModified := "", ""
+	if hasCache {
+		etag, lastModified = meta.ETag, meta.LastModified
+	}
+	resp, signature, err := fetchPair(etag, lastModified)
+	if err != nil {
+		if hasCache && !options.Strict {
+			options.warn("%v - using the copy cached at %v", err, meta.FetchedAt.Format(time.RFC1123))
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	body := resp.Body
+	if resp.NotModified {
+		if !hasCache {
+			return nil, errors.New("unexpected 304 response for " + url)
+		}
+		body = cached
+	}
+	if err = verify(body, signature); err != nil {
+		return nil, err
+	}
+
+	// failing to write the cache shouldn't stop us using the manifest we just fetched
+	if resp.NotModified {
+		meta.FetchedAt = time.Now()
+		_ = cache.putSigned(nil, signature, meta)
+	} else {
+		_ = cache.putSigned(resp.Body, signature, &manifestCacheMeta{
+			Url:          url,
+			ETag:         resp.ETag,
+			LastModified: resp.LastModified,
+			FetchedAt:    time.Now(),
+		})
+	}
+	return body, nil
+}
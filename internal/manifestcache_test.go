@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cacheTestManifest = `scaffolds:
+  - name: cached
+    git_repo: https://github.com/example/cached.git
+    branch: main
+`
+
+func newManifestServer(t *testing.T, requests *int, conditional *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			*conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(cacheTestManifest))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchManifestCache(t *testing.T) {
+	requests, conditional := 0, 0
+	server := newManifestServer(t, &requests, &conditional)
+	cache := NewManifestCache(t.TempDir(), time.Hour)
+
+	if _, err := fetchManifest(server.URL, ManifestOptions{Offline: true, Cache: cache}); err == nil {
+		t.Errorf("fetchManifest() offline with an empty cache expected an error")
+	}
+
+	for i := 0; i < 2; i++ {
+		body, err := fetchManifest(server.URL, ManifestOptions{Cache: cache})
+		if err != nil {
+			t.Fatalf("fetchManifest() error = %v", err)
+		}
+		if string(body) != cacheTestManifest {
+			t.Errorf("fetchManifest() got = %v, want %v", string(body), cacheTestManifest)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("fetchManifest() within TTL made %v requests, want 1", requests)
+	}
+
+	body, err := fetchManifest(server.URL, ManifestOptions{Cache: cache, Refresh: true})
+	if err != nil {
+		t.Fatalf("fetchManifest() refresh error = %v", err)
+	}
+	if string(body) != cacheTestManifest || conditional != 1 {
+		t.Errorf("fetchManifest() refresh should revalidate with a conditional request, got %v conditional requests", conditional)
+	}
+
+	_, meta, err := cache.Get(server.URL)
+	if err != nil {
+		t.Fatalf("cache.Get() error = %v", err)
+	}
+	meta.FetchedAt = time.Now().Add(-2 * time.Hour)
+	if err = cache.Put(nil, meta); err != nil {
+		t.Fatalf("cache.Put() error = %v", err)
+	}
+	if _, err = fetchManifest(server.URL, ManifestOptions{Cache: cache}); err != nil {
+		t.Fatalf("fetchManifest() after expiry error = %v", err)
+	}
+	if conditional != 2 {
+		t.Errorf("fetchManifest() after expiry should revalidate, got %v conditional requests", conditional)
+	}
+
+	server.Close()
+	var warnings bytes.Buffer
+	body, err = fetchManifest(server.URL, ManifestOptions{Cache: cache, Refresh: true, Warnings: &warnings})
+	if err != nil || string(body) != cacheTestManifest {
+		t.Errorf("fetchManifest() should fall back to the cache when the server is unreachable, got err = %v", err)
+	}
+	if !strings.Contains(warnings.String(), "using the copy cached at") {
+		t.Errorf("fetchManifest() should warn when falling back to the cache, got %q", warnings.String())
+	}
+	if _, err = fetchManifest(server.URL, ManifestOptions{Cache: cache, Refresh: true, Strict: true}); err == nil {
+		t.Errorf("fetchManifest() strict should not fall back to the cache")
+	}
+	body, err = fetchManifest(server.URL, ManifestOptions{Cache: cache, Offline: true})
+	if err != nil || string(body) != cacheTestManifest {
+		t.Errorf("fetchManifest() offline should use the cache, got err = %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// netrc.go reads credentials from the user's ~/.netrc, as curl and git do.
+
+type netrcEntry struct {
+	Machine  string
+	Login    string
+	Password string
+}
+
+// netrcPath returns $NETRC, or ~/.netrc
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// parseNetrc parses the machine, login and password tokens of a netrc file. Entries with no machine are `default` entries.
+func parseNetrc(data string) []netrcEntry {
+	var entries []netrcEntry
+	var current *netrcEntry
+	tokens := strings.Fields(data)
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if i+1 < len(tokens) {
+				entries = append(entries, netrcEntry{Machine: tokens[i+1]})
+				current = &entries[len(entries)-1]
+				i++
+			}
+		case "default":
+			entries = append(entries, netrcEntry{})
+			current = &entries[len(entries)-1]
+		case "login", "password", "account":
+			if i+1 < len(tokens) && current != nil {
+				if tokens[i] == "login" {
+					current.Login = tokens[i+1]
+				} else if tokens[i] == "password" {
+					current.Password = tokens[i+1]
+				}
+				i++
+			}
+		case "macdef":
+			// macros run until a blank line, which Fields has already discarded - we can't use them anyway
+			current = nil
+		}
+	}
+	return entries
+}
+
+// netrcCredentials returns the login and password for host from the user's netrc file, if there are any
+func netrcCredentials(host string) (string, string, bool) {
+	path := netrcPath()
+	if path == "" {
+		return "", "", false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", false
+	}
+	var fallback *netrcEntry
+	entries := parseNetrc(string(data))
+	for i, entry := range entries {
+		if entry.Machine == host {
+			return entry.Login, entry.Password, true
+		}
+		if entry.Machine == "" && fallback == nil {
+			fallback = &entries[i]
+		}
+	}
+	if fallback != nil {
+		return fallback.Login, fallback.Password, true
+	}
+	return "", "", false
+}
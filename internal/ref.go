@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"regexp"
+)
+
+// ref.go works out exactly what we should check out of a scaffold's repository.
+
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// ResolvedRef is either a branch or tag reference, or a (possibly abbreviated) commit
+type ResolvedRef struct {
+	ReferenceName plumbing.ReferenceName
+	Commit        string
+}
+
+func (r ResolvedRef) String() string {
+	if r.Commit != "" {
+		return "commit " + r.Commit
+	}
+	if r.ReferenceName == "" {
+		return "default branch"
+	}
+	if r.ReferenceName.IsTag() {
+		return "tag " + r.ReferenceName.Short()
+	}
+	return "branch " + r.ReferenceName.Short()
+}
+
+// needsRemoteRefs is true when we can't resolve a ref without listing the repository's refs
+func needsRemoteRefs(repo ScaffoldRepo, override string) bool {
+	if override != "" {
+		return true
+	}
+	return repo.Commit == "" && repo.Tag == "" && repo.Version != ""
+}
+
+// ResolveRef works out what to check out for a scaffold - in order of precedence, override (usually --ref),
+// then the scaffold's commit, tag, version constraint and branch.
+func ResolveRef(repo ScaffoldRepo, override string, auth transport.AuthMethod) (ResolvedRef, error) {
+	return ResolveRefContext(context.Background(), repo, override, auth)
+}
+
+// ResolveRefContext is ResolveRef, where listing the repository's refs is cancelled when ctx is done
+func ResolveRefContext(ctx context.Context, repo ScaffoldRepo, override string, auth transport.AuthMethod) (ResolvedRef, error) {
+	var refs []*plumbing.Reference
+	if needsRemoteRefs(repo, override) {
+		remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+			Name: "origin",
+			URLs: []string{repo.GitRepo},
+		})
+		var err error
+		refs, err = remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+		if err != nil {
+			return ResolvedRef{}, fmt.Errorf("unable to list refs for %v: %w", repo.GitRepo, err)
+		}
+	}
+	return resolveRefFromList(repo, override, refs)
+}
+
+func resolveRefFromList(repo ScaffoldRepo, override string, refs []*plumbing.Reference) (ResolvedRef, error) {
+	if override != "" {
+		return resolveOverride(override, refs)
+	}
+	switch {
+	case repo.Commit != "":
+		return ResolvedRef{Commit: repo.Commit}, nil
+	case repo.Tag != "":
+		return ResolvedRef{ReferenceName: plumbing.NewTagReferenceName(repo.Tag)}, nil
+	case repo.Version != "":
+		return resolveVersion(repo.Version, refs)
+	case repo.Branch != "":
+		return ResolvedRef{ReferenceName: plumbing.NewBranchReferenceName(repo.Branch)}, nil
+	}
+	return ResolvedRef{}, nil
+}
+
+// resolveOverride treats ref as a tag, branch, commit or version constraint - in that order
+func resolveOverride(ref string, refs []*plumbing.Reference) (ResolvedRef, error) {
+	for _, candidate := range []plumbing.ReferenceName{plumbing.NewTagReferenceName(ref), plumbing.NewBranchReferenceName(ref)} {
+		for _, r := range refs {
+			if r.Name() == candidate {
+				return ResolvedRef{ReferenceName: candidate}, nil
+			}
+		}
+	}
+	if commitPattern.MatchString(ref) {
+		return ResolvedRef{Commit: ref}, nil
+	}
+	if _, err := ParseVersionConstraint(ref); err == nil {
+		return resolveVersion(ref, refs)
+	}
+	return ResolvedRef{}, fmt.Errorf("`%v` is not a tag, branch, commit or version constraint in this repository", ref)
+}
+
+func resolveVersion(version string, refs []*plumbing.Reference) (ResolvedRef, error) {
+	constraint, err := ParseVersionConstraint(version)
+	if err != nil {
+		return ResolvedRef{}, err
+	}
+	var tags []string
+	for _, r := range refs {
+		if r.Name().IsTag() {
+			tags = append(tags, r.Name().Short())
+		}
+	}
+	tag, ok := constraint.Latest(tags)
+	if !ok {
+		return ResolvedRef{}, fmt.Errorf("no tag satisfies version constraint `%v`", version)
+	}
+	return ResolvedRef{ReferenceName: plumbing.NewTagReferenceName(tag)}, nil
+}
+
+// CloneOptions returns the options to clone url at this ref - commits need the full history
+// so are checked out separately with Checkout
+func (r ResolvedRef) CloneOptions(url string) *git.CloneOptions {
+	options := &git.CloneOptions{
+		URL: url,
+	}
+	if r.Commit == "" && r.ReferenceName != "" {
+		options.ReferenceName = r.ReferenceName
+		options.SingleBranch = true
+	}
+	return options
+}
+
+// Checkout moves a freshly cloned repository to the pinned commit, if there is one, returning the commit checked out.
+// If sparseDirs are given, only those directories are checked out - the clone should have been made with NoCheckout.
+func (r ResolvedRef) Checkout(repository *git.Repository, sparseDirs []string) (plumbing.Hash, error) {
+	head, err := repository.Head()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	hash := head.Hash()
+	if r.Commit != "" {
+		resolved, err := repository.ResolveRevision(plumbing.Revision(r.Commit))
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("unable to find commit %v: %w", r.Commit, err)
+		}
+		hash = *resolved
+	} else if len(sparseDirs) == 0 {
+		return hash, nil
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	err = worktree.Checkout(&git.CheckoutOptions{
+		Hash:                      hash,
+		SparseCheckoutDirectories: sparseDirs,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return hash, nil
+}
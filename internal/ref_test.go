@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// newTestRepository creates a git repository with a commit per entry in commits, each writing the given files.
+// Commits are tagged with their key in tags, if present.
+func newTestRepository(t *testing.T, commits []map[string]string, tags map[int]string) (string, []plumbing.Hash) {
+	t.Helper()
+	dir := t.TempDir()
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repository.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hashes []plumbing.Hash
+	for i, files := range commits {
+		for name, content := range files {
+			if err = os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = worktree.Add(name); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hash, err := worktree.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tag, ok := tags[i]; ok {
+			if _, err = repository.CreateTag(tag, hash, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		hashes = append(hashes, hash)
+	}
+	return dir, hashes
+}
+
+func TestResolveRefFromList(t *testing.T) {
+	refs := []*plumbing.Reference{
+		plumbing.NewHashReference(plumbing.NewBranchReferenceName("main"), plumbing.ZeroHash),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("v1.0.0"), plumbing.ZeroHash),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("v1.2.0"), plumbing.ZeroHash),
+		plumbing.NewHashReference(plumbing.NewTagReferenceName("v2.0.0"), plumbing.ZeroHash),
+	}
+	tests := []struct {
+		name     string
+		repo     ScaffoldRepo
+		override string
+		want     ResolvedRef
+		wantErr  bool
+	}{
+		{"branch", ScaffoldRepo{Branch: "main"}, "", ResolvedRef{ReferenceName: "refs/heads/main"}, false},
+		{"tag beats branch", ScaffoldRepo{Branch: "main", Tag: "v1.0.0"}, "", ResolvedRef{ReferenceName: "refs/tags/v1.0.0"}, false},
+		{"commit beats tag", ScaffoldRepo{Tag: "v1.0.0", Commit: "abc1234"}, "", ResolvedRef{Commit: "abc1234"}, false},
+		{"version constraint", ScaffoldRepo{Branch: "main", Version: "^1.0"}, "", ResolvedRef{ReferenceName: "refs/tags/v1.2.0"}, false},
+		{"unsatisfiable version", ScaffoldRepo{Version: "^3.0"}, "", ResolvedRef{}, true},
+		{"override tag", ScaffoldRepo{Branch: "main"}, "v2.0.0", ResolvedRef{ReferenceName: "refs/tags/v2.0.0"}, false},
+		{"override branch", ScaffoldRepo{Tag: "v1.0.0"}, "main", ResolvedRef{ReferenceName: "refs/heads/main"}, false},
+		{"override commit", ScaffoldRepo{Branch: "main"}, "0123456789abcdef", ResolvedRef{Commit: "0123456789abcdef"}, false},
+		{"override version", ScaffoldRepo{Branch: "main"}, "~1.0.0", ResolvedRef{ReferenceName: "refs/tags/v1.0.0"}, false},
+		{"override unknown", ScaffoldRepo{Branch: "main"}, "nope", ResolvedRef{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveRefFromList(tt.repo, tt.override, refs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveRefFromList() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveRefFromList() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRefAndCheckout(t *testing.T) {
+	repoDir, hashes := newTestRepository(t, []map[string]string{
+		{"version.txt": "1.0.0"},
+		{"version.txt": "1.1.0"},
+		{"version.txt": "2.0.0"},
+	}, map[int]string{0: "v1.0.0", 1: "v1.1.0", 2: "v2.0.0"})
+	url := "file://" + repoDir
+
+	tests := []struct {
+		name        string
+		repo        ScaffoldRepo
+		override    string
+		wantVersion string
+	}{
+		{"version constraint", ScaffoldRepo{GitRepo: url, Version: "^1"}, "", "1.1.0"},
+		{"pinned commit", ScaffoldRepo{GitRepo: url, Commit: hashes[0].String()[:8]}, "", "1.0.0"},
+		{"ref override", ScaffoldRepo{GitRepo: url, Version: "^1"}, "v2.0.0", "2.0.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := ResolveRef(tt.repo, tt.override, nil)
+			if err != nil {
+				t.Fatalf("ResolveRef() error = %v", err)
+			}
+			dest := t.TempDir()
+			repository, err := git.PlainClone(dest, false, ref.CloneOptions(url))
+			if err != nil {
+				t.Fatalf("PlainClone() error = %v", err)
+			}
+			if _, err = ref.Checkout(repository, nil); err != nil {
+				t.Fatalf("Checkout() error = %v", err)
+			}
+			got, _ := os.ReadFile(filepath.Join(dest, "version.txt"))
+			if string(got) != tt.wantVersion {
+				t.Errorf("checked out version %v, want %v", string(got), tt.wantVersion)
+			}
+		})
+	}
+}
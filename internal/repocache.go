@@ -0,0 +1,283 @@
+package internal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"gopkg.in/yaml.v2"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repocache.go keeps a bare mirror of every scaffold repository we've cloned (and a copy of every archive
+// we've downloaded), so that later runs only need to fetch what's changed, and can run without network access at all.
+
+type RepoCache struct {
+	Dir string
+	// ArchiveDir holds downloaded scaffold archives, named by their checksum
+	ArchiveDir string
+}
+
+// RepoCacheEntry describes a single cached mirror
+type RepoCacheEntry struct {
+	Url       string    `yaml:"url"` // without any credentials, see mirrorUrl
+	FetchedAt time.Time `yaml:"fetched_at"`
+	UsedAt    time.Time `yaml:"used_at"`
+	Path      string    `yaml:"-"`
+	Size      int64     `yaml:"-"`
+}
+
+// repoCacheLocks stops concurrent fetches (e.g. from manifest verify) trampling over the same mirror
+var repoCacheLocks sync.Map
+
+func NewRepoCache(dir string) *RepoCache {
+	return &RepoCache{
+		Dir:        filepath.Join(dir, "repos"),
+		ArchiveDir: filepath.Join(dir, "archives"),
+	}
+}
+
+func (c *RepoCache) archivePath(sha256 string) string {
+	return filepath.Join(c.ArchiveDir, sha256+".archive")
+}
+
+// GetArchive returns the cached archive with the given checksum, if any
+func (c *RepoCache) GetArchive(sha256 string) ([]byte, error) {
+	return os.ReadFile(c.archivePath(sha256))
+}
+
+// PutArchive caches an archive - it should already have been checked against sha256
+func (c *RepoCache) PutArchive(sha256 string, data []byte) error {
+	// archives may have been downloaded from private hosts, so are kept private
+	return writePrivateFile(c.archivePath(sha256), data)
+}
+
+// mirrorUrl is location without any credentials - mirrors are recorded, and found, by it
+func mirrorUrl(location string) string {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Host == "" {
+		return location
+	}
+	if parsed.Scheme == "http" || parsed.Scheme == "https" {
+		// tokens are often given as the username alone
+		parsed.User = nil
+	}
+	return RedactUrl(parsed.String())
+}
+
+func (c *RepoCache) paths(location string) (string, string) {
+	sum := sha256.Sum256([]byte(mirrorUrl(location)))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.Dir, key+".git"), filepath.Join(c.Dir, key+".meta.yml")
+}
+
+// Mirror makes sure the cache holds an up to date mirror of url, returning the mirror's path.
+// When offline, an existing mirror is used as is. If a mirror can't be updated we warn and use it anyway.
+func (c *RepoCache) Mirror(ctx context.Context, url string, auth transport.AuthMethod, offline bool, progress io.Writer) (string, error) {
+	mirrorPath, metaPath := c.paths(url)
+	lock, _ := repoCacheLocks.LoadOrStore(mirrorPath, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	entry, err := readRepoCacheEntry(metaPath)
+	if errors.Is(err, os.ErrNotExist) {
+		entry = &RepoCacheEntry{}
+	} else if err != nil {
+		return "", err
+	}
+	_, err = os.Stat(mirrorPath)
+	cached := err == nil
+
+	switch {
+	case offline && !cached:
+		return "", fmt.Errorf("%v is not cached, and cannot be fetched while offline", RedactUrl(url))
+	case offline:
+	case !cached:
+		printProgress(progress, "Caching a mirror of %v", RedactUrl(url))
+		// mirrors may be of private repositories, so are kept private
+		if err = os.MkdirAll(c.Dir, 0700); err != nil {
+			return "", err
+		}
+		if err = os.Chmod(c.Dir, 0700); err != nil {
+			return "", err
+		}
+		if err = cloneMirror(ctx, mirrorPath, url, auth, progress); err != nil {
+			os.RemoveAll(mirrorPath)
+			return "", fmt.Errorf("unable to clone %v: %w", RedactUrl(url), err)
+		}
+		entry.FetchedAt = time.Now()
+	default:
+		printProgress(progress, "Updating the cached mirror of %v", RedactUrl(url))
+		if err = updateMirror(ctx, mirrorPath, url, auth, progress); errors.Is(err, transport.ErrAuthenticationRequired) {
+			// not a network failure - the server wants credentials, which the caller may be able to retry with
+			return "", fmt.Errorf("unable to update the cached mirror of %v: %w", RedactUrl(url), err)
+		} else if err != nil {
+			printProgress(progress, "Warning: unable to update the cached mirror of %v, using the copy fetched at %v: %v",
+				RedactUrl(url), entry.FetchedAt.Format(time.RFC3339), err)
+		} else {
+			entry.FetchedAt = time.Now()
+		}
+	}
+
+	entry.Url = mirrorUrl(url)
+	entry.UsedAt = time.Now()
+	rawEntry, err := yaml.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+	return mirrorPath, writePrivateFile(metaPath, rawEntry)
+}
+
+// cloneMirror clones a new mirror of url, leaving any credentials in url out of the mirror's config
+func cloneMirror(ctx context.Context, mirrorPath string, url string, auth transport.AuthMethod, progress io.Writer) error {
+	repository, err := git.PlainCloneContext(ctx, mirrorPath, true, &git.CloneOptions{URL: url, Auth: auth, Mirror: true, Progress: progress})
+	if err != nil {
+		return err
+	}
+	config, err := repository.Config()
+	if err != nil {
+		return err
+	}
+	if origin, ok := config.Remotes["origin"]; ok {
+		origin.URLs = []string{mirrorUrl(url)}
+	}
+	return repository.SetConfig(config)
+}
+
+// updateMirror fetches url into an existing mirror - url is given each time, as the mirror's config doesn't hold its credentials
+func updateMirror(ctx context.Context, mirrorPath string, url string, auth transport.AuthMethod, progress io.Writer) error {
+	repository, err := git.PlainOpen(mirrorPath)
+	if err != nil {
+		return err
+	}
+	err = repository.FetchContext(ctx, &git.FetchOptions{
+		RemoteName: "origin",
+		RemoteURL:  url,
+		RefSpecs:   []config.RefSpec{"+refs/*:refs/*"},
+		Auth:       auth,
+		Progress:   progress,
+		Force:      true,
+		Prune:      true,
+	})
+	if errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil
+	}
+	return err
+}
+
+func readRepoCacheEntry(metaPath string) (*RepoCacheEntry, error) {
+	rawEntry, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, err
+	}
+	entry := &RepoCacheEntry{}
+	if err = yaml.Unmarshal(rawEntry, entry); err != nil {
+		return nil, fmt.Errorf("unable to parse %v: %w", metaPath, err)
+	}
+	return entry, nil
+}
+
+// List returns every cached mirror, ordered by url
+func (c *RepoCache) List() ([]RepoCacheEntry, error) {
+	files, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []RepoCacheEntry
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".meta.yml") {
+			continue
+		}
+		entry, err := readRepoCacheEntry(filepath.Join(c.Dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		// mirrors recorded before their urls were stripped of credentials aren't found by their url
+		entry.Path = filepath.Join(c.Dir, strings.TrimSuffix(file.Name(), ".meta.yml")+".git")
+		entry.Size, _ = dirSize(entry.Path)
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Url < entries[j].Url
+	})
+	return entries, nil
+}
+
+// Remove deletes the mirror of url
+func (c *RepoCache) Remove(url string) error {
+	mirrorPath, _ := c.paths(url)
+	return removeMirror(mirrorPath)
+}
+
+// removeMirror deletes a mirror, and its metadata
+func removeMirror(mirrorPath string) error {
+	if err := os.RemoveAll(mirrorPath); err != nil {
+		return err
+	}
+	metaPath := strings.TrimSuffix(mirrorPath, ".git") + ".meta.yml"
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Prune removes every mirror that hasn't been used since before, returning those removed
+func (c *RepoCache) Prune(before time.Time) ([]RepoCacheEntry, error) {
+	entries, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+	var pruned []RepoCacheEntry
+	for _, entry := range entries {
+		if !entry.UsedAt.Before(before) {
+			continue
+		}
+		if err = removeMirror(entry.Path); err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, entry)
+	}
+	return pruned, nil
+}
+
+// Clear removes every cached mirror and archive
+func (c *RepoCache) Clear() error {
+	if err := os.RemoveAll(c.Dir); err != nil {
+		return err
+	}
+	return os.RemoveAll(c.ArchiveDir)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func printProgress(progress io.Writer, format string, args ...interface{}) {
+	if progress != nil {
+		fmt.Fprintf(progress, format+"\n", args...)
+	}
+}
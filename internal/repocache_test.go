@@ -0,0 +1,145 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestRepoCacheSource(t *testing.T) {
+	origin, _ := newTestRepository(t, []map[string]string{{"version.txt": "1"}}, map[int]string{0: "v1.0.0"})
+	cache := NewRepoCache(t.TempDir())
+	repo := ScaffoldRepo{Name: "cached", GitRepo: "file://" + origin, Branch: "master"}
+
+	fetch := func(ref string, offline bool) (string, error) {
+		t.Helper()
+		source, err := NewSource(repo, SourceOptions{Ref: ref, Cache: cache, Offline: offline})
+		if err != nil {
+			t.Fatalf("NewSource() error = %v", err)
+		}
+		dest := t.TempDir()
+		if err = source.Fetch(dest); err != nil {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(dest, ".git")); err == nil {
+			t.Errorf("Fetch() left a .git directory behind")
+		}
+		version, err := os.ReadFile(filepath.Join(dest, "version.txt"))
+		return string(version), err
+	}
+
+	if got, err := fetch("", false); err != nil || got != "1" {
+		t.Fatalf("first Fetch() got = %q, %v, want 1", got, err)
+	}
+
+	// a new commit upstream should be picked up by an incremental fetch into the mirror
+	repository, err := git.PlainOpen(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, _ := repository.Worktree()
+	os.WriteFile(filepath.Join(origin, "version.txt"), []byte("2"), 0644)
+	worktree.Add("version.txt")
+	hash, err := worktree.Commit("second", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	repository.CreateTag("v2.0.0", hash, nil)
+
+	if got, err := fetch("v2.0.0", false); err != nil || got != "2" {
+		t.Fatalf("Fetch() after a new tag got = %q, %v, want 2", got, err)
+	}
+
+	// once the origin's unreachable, offline runs should still work from the mirror, and online runs fall back to it
+	os.Remove(filepath.Join(origin, ".git", "HEAD"))
+	if got, err := fetch("v1.0.0", true); err != nil || got != "1" {
+		t.Fatalf("offline Fetch() got = %q, %v, want 1", got, err)
+	}
+	if got, err := fetch("", false); err != nil || got != "2" {
+		t.Fatalf("Fetch() with an unreachable origin got = %q, %v, want the cached 2", got, err)
+	}
+
+	uncached := ScaffoldRepo{GitRepo: "https://git.invalid/uncached.git"}
+	source, _ := NewSource(uncached, SourceOptions{Cache: cache, Offline: true})
+	if err := source.Fetch(t.TempDir()); err == nil {
+		t.Errorf("offline Fetch() of an uncached repository should fail")
+	}
+
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 || entries[0].Url != repo.GitRepo {
+		t.Fatalf("List() got = %v, %v, want just %v", entries, err, repo.GitRepo)
+	}
+	if entries[0].Size == 0 {
+		t.Errorf("List() got a zero size mirror")
+	}
+
+	pruned, err := cache.Prune(time.Now().Add(-time.Hour))
+	if err != nil || len(pruned) != 0 {
+		t.Errorf("Prune() of recently used mirrors got = %v, %v, want none pruned", pruned, err)
+	}
+	pruned, err = cache.Prune(time.Now())
+	if err != nil || len(pruned) != 1 {
+		t.Errorf("Prune() got = %v, %v, want 1 pruned", pruned, err)
+	}
+	if entries, _ = cache.List(); len(entries) != 0 {
+		t.Errorf("List() after Prune() got = %v, want none", entries)
+	}
+}
+
+func TestRepoCacheMirrorIsPrivate(t *testing.T) {
+	origin, _ := newTestRepository(t, []map[string]string{{"version.txt": "1"}}, nil)
+	server := newGitHTTPServer(t, filepath.Dir(origin), "me", "s3cret")
+	repoUrl := strings.Replace(server.URL, "http://", "http://me:s3cret@", 1) + "/" + filepath.Base(origin) + "/.git"
+	cache := NewRepoCache(t.TempDir())
+
+	// the second fetch updates the mirror, which needs the credentials in the url too
+	for i := 0; i < 2; i++ {
+		source, err := NewSource(ScaffoldRepo{GitRepo: repoUrl}, SourceOptions{Cache: cache})
+		if err != nil {
+			t.Fatalf("NewSource() error = %v", err)
+		}
+		var progress bytes.Buffer
+		source.(*gitSource).options.Progress = &progress
+		if err = source.Fetch(t.TempDir()); err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+		if strings.Contains(progress.String(), "Warning") {
+			t.Errorf("Fetch() warned: %v", progress.String())
+		}
+	}
+
+	entries, err := cache.List()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("List() got = %v, %v, want one mirror", entries, err)
+	}
+	if strings.Contains(entries[0].Url, "s3cret") || strings.Contains(entries[0].Url, "me@") {
+		t.Errorf("List() got url %v, want it without credentials", entries[0].Url)
+	}
+	mirrorPath, metaPath := cache.paths(repoUrl)
+	if mirrorPath != entries[0].Path {
+		t.Errorf("List() got path %v, want %v", entries[0].Path, mirrorPath)
+	}
+	for _, file := range []string{metaPath, filepath.Join(mirrorPath, "config")} {
+		contents, _ := os.ReadFile(file)
+		if strings.Contains(string(contents), "s3cret") {
+			t.Errorf("%v holds the repository's credentials", file)
+		}
+	}
+	for path, want := range map[string]os.FileMode{cache.Dir: 0700, metaPath: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%v has permissions %v, want %v", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// rewrite.go implements git style `insteadOf` url rewriting, so that manifests and scaffolds pointing at
+// e.g. github.com can be fetched from an internal mirror without editing the manifests themselves.
+
+// URLRewrite replaces any of the InsteadOf prefixes with URL, just like git's url.<base>.insteadOf
+type URLRewrite struct {
+	URL       string   `yaml:"url"`
+	InsteadOf []string `yaml:"instead_of"`
+}
+
+type URLRewriter struct {
+	Rules []URLRewrite
+	// Explain, if set, receives a line describing every url we're asked to rewrite
+	Explain io.Writer
+}
+
+// Rewrite applies the rule with the longest matching prefix to location, returning it unchanged if no rule matches.
+// A nil rewriter never rewrites anything.
+func (r *URLRewriter) Rewrite(location string) string {
+	if r == nil {
+		return location
+	}
+	var base, prefix string
+	for _, rule := range r.Rules {
+		for _, insteadOf := range rule.InsteadOf {
+			if insteadOf != "" && strings.HasPrefix(location, insteadOf) && len(insteadOf) > len(prefix) {
+				base, prefix = rule.URL, insteadOf
+			}
+		}
+	}
+	if prefix == "" {
+		r.explain("%v is not rewritten", RedactUrl(location))
+		return location
+	}
+	rewritten := base + strings.TrimPrefix(location, prefix)
+	r.explain("%v is rewritten to %v (%v instead of %v)", RedactUrl(location), RedactUrl(rewritten), RedactUrl(base), RedactUrl(prefix))
+	return rewritten
+}
+
+func (r *URLRewriter) explain(format string, args ...interface{}) {
+	if r.Explain != nil {
+		fmt.Fprintf(r.Explain, format+"\n", args...)
+	}
+}
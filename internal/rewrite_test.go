@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLRewriterRewrite(t *testing.T) {
+	rewriter := &URLRewriter{Rules: []URLRewrite{
+		{URL: "https://git.internal/mirror/", InsteadOf: []string{"https://github.com/", "git@github.com:"}},
+		{URL: "https://git.internal/lagoon/", InsteadOf: []string{"https://github.com/uselagoon/"}},
+	}}
+
+	tests := []struct {
+		name     string
+		location string
+		want     string
+	}{
+		{"prefix", "https://github.com/example/scaffold.git", "https://git.internal/mirror/example/scaffold.git"},
+		{"scp-like", "git@github.com:example/scaffold.git", "https://git.internal/mirror/example/scaffold.git"},
+		{"longest prefix wins", "https://github.com/uselagoon/lagoon-scaffold.git", "https://git.internal/lagoon/lagoon-scaffold.git"},
+		{"no match", "https://gitlab.com/example/scaffold.git", "https://gitlab.com/example/scaffold.git"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewriter.Rewrite(tt.location); got != tt.want {
+				t.Errorf("Rewrite() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got, want := rewriteManifestLocation("git+https://github.com/example/manifests.git#main:scaffolds.yml", rewriter),
+		"git+https://git.internal/mirror/example/manifests.git#main:scaffolds.yml"; got != want {
+		t.Errorf("rewriteManifestLocation() got = %v, want %v", got, want)
+	}
+
+	var nilRewriter *URLRewriter
+	if got := nilRewriter.Rewrite("https://github.com/a"); got != "https://github.com/a" {
+		t.Errorf("nil Rewrite() got = %v", got)
+	}
+}
+
+func TestURLRewriterExplain(t *testing.T) {
+	var explained bytes.Buffer
+	rewriter := &URLRewriter{
+		Rules:   []URLRewrite{{URL: "https://mirror.internal/", InsteadOf: []string{"https://github.com/"}}},
+		Explain: &explained,
+	}
+	rewriter.Rewrite("https://github.com/example/scaffold.tar.gz?token=s3cret")
+	rewriter.Rewrite("https://gitlab.com/example/scaffold.git")
+
+	output := explained.String()
+	if !strings.Contains(output, "rewritten to https://mirror.internal/example/scaffold.tar.gz?token=") {
+		t.Errorf("Explain output %q doesn't show the rewritten url", output)
+	}
+	if !strings.Contains(output, "https://gitlab.com/example/scaffold.git is not rewritten") {
+		t.Errorf("Explain output %q doesn't show the unmatched url", output)
+	}
+	if strings.Contains(output, "s3cret") {
+		t.Errorf("Explain output %q leaks credentials", output)
+	}
+}
+
+func TestRewrittenManifestAndSource(t *testing.T) {
+	mirror := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(cacheTestManifest))
+	}))
+	defer mirror.Close()
+
+	rewriter := &URLRewriter{Rules: []URLRewrite{
+		{URL: mirror.URL + "/", InsteadOf: []string{"https://manifests.invalid/"}},
+	}}
+	source := ManifestSource{Name: "mirrored", Location: "https://manifests.invalid/scaffolds.yml"}
+	if _, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Rewriter: rewriter}); err != nil {
+		t.Errorf("GetScaffolds() through a rewrite error = %v", err)
+	}
+
+	gitDir, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	rewriter = &URLRewriter{Rules: []URLRewrite{
+		{URL: "file://" + gitDir, InsteadOf: []string{"https://github.com/example/scaffold.git"}},
+	}}
+	scaffoldSource, err := NewSource(ScaffoldRepo{GitRepo: "https://github.com/example/scaffold.git"}, SourceOptions{Rewriter: rewriter})
+	if err != nil {
+		t.Fatalf("NewSource() error = %v", err)
+	}
+	dest := t.TempDir()
+	if err := scaffoldSource.Fetch(dest); err != nil {
+		t.Fatalf("Fetch() through a rewrite error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+		t.Errorf("Fetch() through a rewrite didn't fetch flow.yml: %v", err)
+	}
+}
+
+func TestRewrittenManifestCache(t *testing.T) {
+	newMirror := func(manifest string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(manifest))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	oldMirror := newMirror(cacheTestManifest)
+	newerMirror := newMirror(strings.Replace(cacheTestManifest, "cached", "mirrored", -1))
+	rewriterTo := func(mirror *httptest.Server) *URLRewriter {
+		return &URLRewriter{Rules: []URLRewrite{{URL: mirror.URL + "/", InsteadOf: []string{"https://manifests.invalid/"}}}}
+	}
+	source := ManifestSource{Name: "mirrored", Location: "https://manifests.invalid/scaffolds.yml"}
+	cache := NewManifestCache(t.TempDir(), time.Hour)
+
+	if _, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Rewriter: rewriterTo(oldMirror)}); err != nil {
+		t.Fatalf("GetScaffolds() error = %v", err)
+	}
+
+	// once the rewrite changes, the copy cached from the old mirror isn't used, however fresh it is
+	var explained bytes.Buffer
+	rewriter := rewriterTo(newerMirror)
+	rewriter.Explain = &explained
+	scaffolds, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Rewriter: rewriter})
+	if _, ok := scaffolds["mirrored"]; err != nil || !ok {
+		t.Errorf("GetScaffolds() after the rewrite changed got = %v, %v, want the scaffold from the new mirror", scaffolds, err)
+	}
+	if !strings.Contains(explained.String(), "is rewritten to "+newerMirror.URL) {
+		t.Errorf("Explain output %q doesn't show the manifest's rewrite", explained.String())
+	}
+
+	explained.Reset()
+	scaffolds, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Rewriter: rewriter, Offline: true})
+	if _, ok := scaffolds["mirrored"]; err != nil || !ok {
+		t.Errorf("GetScaffolds() offline got = %v, %v, want the scaffold cached from the new mirror", scaffolds, err)
+	}
+	if !strings.Contains(explained.String(), "is rewritten to "+newerMirror.URL) {
+		t.Errorf("Explain output %q doesn't show the rewrite of a cached manifest", explained.String())
+	}
+}
@@ -0,0 +1,141 @@
+package internal
+
+import (
+	"fmt"
+	"golang.org/x/mod/semver"
+	"sort"
+	"strings"
+)
+
+// semver.go implements just enough of semver constraints to pin scaffolds to a range of tagged releases.
+// Constraints are made up of comma separated comparisons, e.g. ">=1.2.0, <2.0.0", "^1.4" or "~1.4.2".
+
+type versionComparison struct {
+	operator string
+	version  string
+}
+
+type VersionConstraint struct {
+	raw         string
+	comparisons []versionComparison
+}
+
+// canonicalVersion accepts versions with or without a leading `v`, returning "" if it isn't valid semver
+func canonicalVersion(version string) string {
+	version = strings.TrimSpace(version)
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return ""
+	}
+	return semver.Canonical(version)
+}
+
+// nextVersion returns the lowest version excluded by a ^ or ~ range starting at version
+func nextVersion(operator string, version string, specified int) string {
+	var major, minor, patch int
+	fmt.Sscanf(version, "v%d.%d.%d", &major, &minor, &patch)
+	switch {
+	case operator == "~" && specified > 1:
+		return fmt.Sprintf("v%d.%d.0", major, minor+1)
+	case operator == "~":
+		return fmt.Sprintf("v%d.0.0", major+1)
+	case major > 0 || specified == 1:
+		return fmt.Sprintf("v%d.0.0", major+1)
+	case minor > 0 || specified == 2:
+		return fmt.Sprintf("v0.%d.0", minor+1)
+	default:
+		return fmt.Sprintf("v0.0.%d", patch+1)
+	}
+}
+
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	parsed := &VersionConstraint{raw: constraint}
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		operator := ""
+		for _, op := range []string{">=", "<=", "!=", ">", "<", "=", "^", "~"} {
+			if strings.HasPrefix(part, op) {
+				operator = op
+				break
+			}
+		}
+		rawVersion := strings.TrimSpace(strings.TrimPrefix(part, operator))
+		version := canonicalVersion(rawVersion)
+		if version == "" {
+			return nil, fmt.Errorf("invalid version `%v` in constraint `%v`", rawVersion, constraint)
+		}
+		switch operator {
+		case "^", "~":
+			specified := len(strings.Split(strings.TrimPrefix(rawVersion, "v"), "."))
+			parsed.comparisons = append(parsed.comparisons,
+				versionComparison{">=", version},
+				versionComparison{"<", nextVersion(operator, version, specified)},
+			)
+		case "":
+			parsed.comparisons = append(parsed.comparisons, versionComparison{"=", version})
+		default:
+			parsed.comparisons = append(parsed.comparisons, versionComparison{operator, version})
+		}
+	}
+	if len(parsed.comparisons) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	return parsed, nil
+}
+
+// Check reports whether version satisfies every comparison in the constraint.
+// Prerelease versions are never matched.
+func (c *VersionConstraint) Check(version string) bool {
+	version = canonicalVersion(version)
+	if version == "" || semver.Prerelease(version) != "" {
+		return false
+	}
+	for _, comparison := range c.comparisons {
+		result := semver.Compare(version, comparison.version)
+		var ok bool
+		switch comparison.operator {
+		case ">=":
+			ok = result >= 0
+		case "<=":
+			ok = result <= 0
+		case ">":
+			ok = result > 0
+		case "<":
+			ok = result < 0
+		case "!=":
+			ok = result != 0
+		default:
+			ok = result == 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Latest returns the highest of versions satisfying the constraint
+func (c *VersionConstraint) Latest(versions []string) (string, bool) {
+	var matching []string
+	for _, version := range versions {
+		if c.Check(version) {
+			matching = append(matching, version)
+		}
+	}
+	if len(matching) == 0 {
+		return "", false
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		return semver.Compare(canonicalVersion(matching[i]), canonicalVersion(matching[j])) > 0
+	})
+	return matching[0], true
+}
+
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
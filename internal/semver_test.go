@@ -0,0 +1,57 @@
+package internal
+
+import "testing"
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{"1.2.3", "v1.2.3", true},
+		{"=1.2.3", "1.2.4", false},
+		{">=1.2.0, <2.0.0", "1.9.9", true},
+		{">=1.2.0, <2.0.0", "2.0.0", false},
+		{"^1.2", "1.8.0", true},
+		{"^1.2", "2.0.0", false},
+		{"^1.2", "1.1.9", false},
+		{"^0.2.1", "0.2.9", true},
+		{"^0.2.1", "0.3.0", false},
+		{"~1.2.3", "1.2.9", true},
+		{"~1.2.3", "1.3.0", false},
+		{"~1", "1.9.0", true},
+		{">1.0.0", "1.0.1-beta", false},
+		{"!=1.0.0", "1.0.0", false},
+		{">=1.0.0", "not-a-version", false},
+	}
+	for _, tt := range tests {
+		constraint, err := ParseVersionConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%q) error = %v", tt.constraint, err)
+			continue
+		}
+		if got := constraint.Check(tt.version); got != tt.want {
+			t.Errorf("%q.Check(%q) = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", ">=banana", "^"} {
+		if _, err := ParseVersionConstraint(invalid); err == nil {
+			t.Errorf("ParseVersionConstraint(%q) expected an error", invalid)
+		}
+	}
+}
+
+func TestVersionConstraintLatest(t *testing.T) {
+	constraint, err := ParseVersionConstraint("^1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := constraint.Latest([]string{"v1.0.0", "1.10.0", "v1.9.0", "v2.0.0", "v1.11.0-rc1", "latest"})
+	if !ok || got != "1.10.0" {
+		t.Errorf("Latest() = %v, %v; want 1.10.0, true", got, ok)
+	}
+	if _, ok = constraint.Latest([]string{"v2.0.0"}); ok {
+		t.Errorf("Latest() with no matching versions should return false")
+	}
+}
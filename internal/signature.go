@@ -0,0 +1,183 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/blake2b"
+	"strings"
+)
+
+// signature.go verifies minisign (https://jedisct1.github.io/minisign/) detached signatures,
+// which are expected to sit alongside a manifest with minisign's `.minisig` suffix, or `.sig`.
+
+// signatureSuffixes are tried in order for a manifest's signature
+var signatureSuffixes = []string{".minisig", ".sig"}
+
+// readSignature reads the signature of the manifest at location with read, trying each of signatureSuffixes -
+// if none can be read, the error reading the first is returned
+func readSignature(location string, read func(location string) ([]byte, error)) ([]byte, error) {
+	var firstErr error
+	for _, suffix := range signatureSuffixes {
+		signature, err := read(location + suffix)
+		if err == nil {
+			return signature, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+//go:embed assets/trusted_keys.pub
+var defaultTrustedKeys []byte
+
+// SignatureError is returned when a manifest's signature is missing or doesn't verify.
+// Unlike other manifest errors, we never fall back to another manifest when we see one of these.
+type SignatureError struct {
+	Location string
+	Err      error
+}
+
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("signature verification failed for %v: %v", e.Location, e.Err)
+}
+
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+type PublicKey struct {
+	KeyId [8]byte
+	Key   ed25519.PublicKey
+}
+
+// ParsePublicKey parses a base64 encoded minisign public key
+func ParsePublicKey(encoded string) (PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return PublicKey{}, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return PublicKey{}, errors.New("invalid public key: not a minisign ed25519 key")
+	}
+	key := PublicKey{Key: ed25519.PublicKey(raw[10:])}
+	copy(key.KeyId[:], raw[2:10])
+	return key, nil
+}
+
+// ParsePublicKeys parses a list of keys, skipping blank lines and comments so that
+// the contents of minisign .pub files can be used directly
+func ParsePublicKeys(encoded []string) ([]PublicKey, error) {
+	var keys []PublicKey
+	for _, line := range encoded {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "untrusted comment:") {
+			continue
+		}
+		key, err := ParsePublicKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DefaultTrustedKeys returns the keys embedded at build time for the default Lagoon manifest
+func DefaultTrustedKeys() []string {
+	return strings.Split(string(defaultTrustedKeys), "\n")
+}
+
+// VerifySignature checks a minisign signature file against message, using whichever of keys signed it
+func VerifySignature(message []byte, signature []byte, keys []PublicKey) error {
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("malformed signature file")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("malformed signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("malformed trusted comment signature")
+	}
+
+	var key *PublicKey
+	for i := range keys {
+		if bytes.Equal(keys[i].KeyId[:], sig[2:10]) {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("signed with untrusted key %X", sig[2:10])
+	}
+
+	signed := message
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED": // prehashed
+		hash := blake2b.Sum512(message)
+		signed = hash[:]
+	default:
+		return fmt.Errorf("unsupported signature algorithm `%v`", string(sig[:2]))
+	}
+
+	if !ed25519.Verify(key.Key, signed, sig[10:]) {
+		return errors.New("invalid signature")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalMessage := append(append([]byte{}, sig[10:]...), trustedComment...)
+	if !ed25519.Verify(key.Key, globalMessage, globalSig) {
+		return errors.New("invalid trusted comment signature")
+	}
+	return nil
+}
+
+// readVerifiedManifest reads a manifest and, if the source has any trusted keys, its signature.
+// Sources with trusted keys must be signed by one of them.
+func readVerifiedManifest(source ManifestSource, options ManifestOptions) ([]byte, error) {
+	options.credentials = source.Credentials
+	options.catalog = source.Name
+
+	keys, err := ParsePublicKeys(source.PublicKeys)
+	if err != nil {
+		return nil, &SignatureError{Location: source.Location, Err: err}
+	}
+	if len(keys) == 0 {
+		return ReadManifest(source.Location, options)
+	}
+	verify := func(dat []byte, signature []byte) error {
+		if err := VerifySignature(dat, signature, keys); err != nil {
+			return &SignatureError{Location: source.Location, Err: err}
+		}
+		return nil
+	}
+
+	// remote manifests and their signatures are fetched, and cached, together
+	if isRemoteLocation(source.Location) || isGitManifestLocation(source.Location) {
+		return fetchSignedManifest(source.Location, options, verify)
+	}
+
+	dat, err := ReadManifest(source.Location, options)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := readSignature(source.Location, func(location string) ([]byte, error) {
+		return ReadManifest(location, options)
+	})
+	if err != nil {
+		return nil, &SignatureError{Location: source.Location, Err: fmt.Errorf("unable to read signature: %w", err)}
+	}
+	if err = verify(dat, signature); err != nil {
+		return nil, err
+	}
+	return dat, nil
+}
@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignKeyPair generates a key in minisign's format, returning the encoded public key and a signing function
+func minisignKeyPair(t *testing.T, keyId string) (string, func(message []byte, prehash bool) []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedPub := base64.StdEncoding.EncodeToString(append([]byte("Ed"+keyId), pub...))
+	sign := func(message []byte, prehash bool) []byte {
+		alg := "Ed"
+		if prehash {
+			alg = "ED"
+			hash := blake2b.Sum512(message)
+			message = hash[:]
+		}
+		sig := ed25519.Sign(priv, message)
+		trustedComment := "timestamp:1700000000"
+		globalSig := ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))
+		return []byte("untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(append([]byte(alg+keyId), sig...)) + "\n" +
+			"trusted comment: " + trustedComment + "\n" +
+			base64.StdEncoding.EncodeToString(globalSig) + "\n")
+	}
+	return encodedPub, sign
+}
+
+func TestVerifySignature(t *testing.T) {
+	message := []byte(cacheTestManifest)
+	pub, sign := minisignKeyPair(t, "12345678")
+	otherPub, otherSign := minisignKeyPair(t, "87654321")
+	keys, err := ParsePublicKeys([]string{"untrusted comment: minisign public key", pub})
+	if err != nil {
+		t.Fatalf("ParsePublicKeys() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		message   []byte
+		signature []byte
+		wantErr   bool
+	}{
+		{"valid signature", message, sign(message, false), false},
+		{"valid prehashed signature", message, sign(message, true), false},
+		{"tampered message", []byte("scaffolds: []"), sign(message, true), true},
+		{"untrusted key", message, otherSign(message, true), true},
+		{"garbage", message, []byte("not a signature"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(tt.message, tt.signature, keys)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifySignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err = ParsePublicKey(otherPub[4:]); err == nil {
+		t.Errorf("ParsePublicKey() of a truncated key expected an error")
+	}
+}
+
+func TestReadVerifiedManifest(t *testing.T) {
+	pub, sign := minisignKeyPair(t, "12345678")
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "scaffolds.yml")
+	if err := os.WriteFile(manifest, []byte(cacheTestManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := ManifestSource{Name: "signed", Location: manifest, PublicKeys: []string{pub}}
+
+	var signatureErr *SignatureError
+	if _, err := readVerifiedManifest(source, ManifestOptions{}); !errors.As(err, &signatureErr) {
+		t.Errorf("readVerifiedManifest() with a missing signature error = %v, want a SignatureError", err)
+	}
+
+	if err := os.WriteFile(manifest+".minisig", sign([]byte("scaffolds: []"), true), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{}); !errors.As(err, &signatureErr) {
+		t.Errorf("GetScaffolds() with an invalid signature error = %v, want a SignatureError", err)
+	}
+
+	if err := os.WriteFile(manifest+".minisig", sign([]byte(cacheTestManifest), true), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scaffolds, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{})
+	if err != nil {
+		t.Fatalf("GetScaffolds() with a valid signature error = %v", err)
+	}
+	if _, ok := scaffolds["cached"]; !ok {
+		t.Errorf("GetScaffolds() got = %v, want the `cached` scaffold", scaffolds)
+	}
+
+	// signatures published with a .sig suffix are read too
+	os.Remove(manifest + ".minisig")
+	if err := os.WriteFile(manifest+".sig", sign([]byte(cacheTestManifest), true), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{}); err != nil {
+		t.Errorf("GetScaffolds() with a .sig signature error = %v", err)
+	}
+}
+
+func TestReadVerifiedManifestCachesSignedPairs(t *testing.T) {
+	pub, sign := minisignKeyPair(t, "12345678")
+	updated := strings.Replace(cacheTestManifest, "cached", "updated", -1)
+	manifest, signature := []byte(cacheTestManifest), sign([]byte(cacheTestManifest), true)
+	manifestDown := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".minisig"):
+			w.Write(signature)
+		case manifestDown:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write(manifest)
+		}
+	}))
+	defer server.Close()
+
+	source := ManifestSource{Name: "signed", Location: server.URL + "/scaffolds.yml", PublicKeys: []string{pub}}
+	cache := NewManifestCache(t.TempDir(), time.Hour)
+	if _, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache}); err != nil {
+		t.Fatalf("GetScaffolds() error = %v", err)
+	}
+
+	// the manifest is updated, but only its signature can be fetched - we fall back to the cached
+	// manifest and signature together, rather than checking the old manifest against the new signature
+	manifest, signature = []byte(updated), sign([]byte(updated), true)
+	manifestDown = true
+	var warnings bytes.Buffer
+	scaffolds, err := GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Refresh: true, Warnings: &warnings})
+	if err != nil {
+		t.Fatalf("GetScaffolds() with the manifest unavailable error = %v", err)
+	}
+	if _, ok := scaffolds["cached"]; !ok || !strings.Contains(warnings.String(), "using the copy cached") {
+		t.Errorf("GetScaffolds() with the manifest unavailable got = %v, warnings %q, want the cached scaffold", scaffolds, warnings.String())
+	}
+
+	manifestDown = false
+	scaffolds, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Refresh: true})
+	if _, ok := scaffolds["updated"]; err != nil || !ok {
+		t.Errorf("GetScaffolds() after the update got = %v, error = %v, want the updated scaffold", scaffolds, err)
+	}
+	scaffolds, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Offline: true})
+	if _, ok := scaffolds["updated"]; err != nil || !ok {
+		t.Errorf("GetScaffolds() offline got = %v, error = %v, want the updated scaffold from the cache", scaffolds, err)
+	}
+
+	// a freshly fetched pair that doesn't verify is never fallen back from
+	signature = sign([]byte(cacheTestManifest), true)
+	var signatureErr *SignatureError
+	if _, err = GetScaffolds([]ManifestSource{source}, ManifestOptions{Cache: cache, Refresh: true}); !errors.As(err, &signatureErr) {
+		t.Errorf("GetScaffolds() with a mismatched signature error = %v, want a SignatureError", err)
+	}
+}
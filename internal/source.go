@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	cp "github.com/otiai10/copy"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// source.go deals with getting a scaffold's files onto disk, wherever they happen to live.
+
+// Source fetches a scaffold's files
+type Source interface {
+	// Fetch writes the scaffold's files into dest, which must already exist
+	Fetch(dest string) error
+	String() string
+}
+
+type SourceOptions struct {
+	// Ref overrides the ref pinned in the scaffold's manifest entry
+	Ref string
+	// Auth is used for every git repository - if nil, Authenticator decides
+	Auth          transport.AuthMethod
+	Authenticator *GitAuthenticator
+	// Progress, if set, receives human readable progress information
+	Progress io.Writer
+	// HTTPClient is used to download archives - nil means http.DefaultClient
+	HTTPClient *http.Client
+	// Rewriter, if set, rewrites git_repo and archive urls before they're fetched
+	Rewriter *URLRewriter
+	// Cache, if set, keeps mirrors of the git repositories scaffolds are cloned from, and copies of their archives
+	Cache *RepoCache
+	// Offline only uses cached mirrors, and never touches the network
+	Offline bool
+	// Context, if set, cancels in-flight clones and downloads when it's done
+	Context context.Context
+}
+
+// fetchContext returns the context scaffolds are fetched with
+func (o SourceOptions) fetchContext() context.Context {
+	if o.Context == nil {
+		return context.Background()
+	}
+	return o.Context
+}
+
+// NewSource returns the appropriate Source for a scaffold's manifest entry
+func NewSource(repo ScaffoldRepo, options SourceOptions) (Source, error) {
+	source, err := newSource(repo, options)
+	if err != nil || repo.Subdir == "" {
+		return source, err
+	}
+	subdir, err := cleanSubdir(repo.Subdir)
+	if err != nil {
+		return nil, err
+	}
+	return &subdirSource{source: source, subdir: subdir}, nil
+}
+
+func newSource(repo ScaffoldRepo, options SourceOptions) (Source, error) {
+	if repo.Path != "" {
+		return newLocalSource(repo.Path, options)
+	}
+	if repo.Archive != "" {
+		repo.Archive = options.Rewriter.Rewrite(repo.Archive)
+	}
+	if repo.GitRepo != "" {
+		repo.GitRepo = options.Rewriter.Rewrite(repo.GitRepo)
+	}
+	if repo.Archive != "" {
+		return newArchiveSource(repo, options)
+	}
+	if strings.HasPrefix(repo.GitRepo, "file://") {
+		// file:// urls may point at either a git repository or a plain working copy
+		dir := strings.TrimPrefix(repo.GitRepo, "file://")
+		if !isGitRepository(dir) {
+			return newLocalSource(dir, options)
+		}
+	}
+	if repo.GitRepo == "" {
+		return nil, fmt.Errorf("scaffold `%v` has no git_repo, path or archive", repo.Name)
+	}
+	return &gitSource{repo: repo, options: options}, nil
+}
+
+func isGitRepository(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		return true
+	}
+	// bare repositories
+	_, err := os.Stat(filepath.Join(dir, "HEAD"))
+	return err == nil
+}
+
+type gitSource struct {
+	repo    ScaffoldRepo
+	options SourceOptions
+}
+
+func (s *gitSource) String() string {
+	return s.repo.GitRepo
+}
+
+func (s *gitSource) Fetch(dest string) error {
+	// when we have a cache, we clone from an up to date mirror rather than from the repository itself
+	repo, auth := s.repo, s.options.Auth
+	if auth == nil && s.options.Authenticator != nil && !s.options.Offline {
+		var err error
+		if auth, err = s.options.Authenticator.ScaffoldAuth(repo); err != nil {
+			return err
+		}
+	}
+	if s.options.Cache != nil {
+		var mirror string
+		_, err := s.options.Authenticator.withChallenge(repo.Source, repo.GitRepo, auth, func(auth transport.AuthMethod) (err error) {
+			mirror, err = s.options.Cache.Mirror(s.options.fetchContext(), repo.GitRepo, auth, s.options.Offline, s.options.Progress)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		repo.GitRepo, auth = mirror, nil
+	} else if s.options.Offline {
+		return fmt.Errorf("cannot clone %v while offline without a cache", RedactUrl(repo.GitRepo))
+	}
+
+	var ref ResolvedRef
+	auth, err := s.options.Authenticator.withChallenge(repo.Source, repo.GitRepo, auth, func(auth transport.AuthMethod) (err error) {
+		ref, err = ResolveRefContext(s.options.fetchContext(), repo, s.options.Ref, auth)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	cloneOptions := ref.CloneOptions(repo.GitRepo)
+	cloneOptions.Progress = s.options.Progress
+
+	// for scaffolds in a subdirectory we only check out that subdirectory
+	var sparseDirs []string
+	if s.repo.Subdir != "" {
+		subdir, err := cleanSubdir(s.repo.Subdir)
+		if err != nil {
+			return err
+		}
+		sparseDirs = []string{subdir}
+		cloneOptions.NoCheckout = true
+	}
+
+	var repository *git.Repository
+	_, err = s.options.Authenticator.withChallenge(repo.Source, repo.GitRepo, auth, func(auth transport.AuthMethod) (err error) {
+		cloneOptions.Auth = auth
+		repository, err = git.PlainCloneContext(s.options.fetchContext(), dest, false, cloneOptions)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	commit, err := ref.Checkout(repository, sparseDirs)
+	if err != nil {
+		return err
+	}
+	if s.options.Progress != nil {
+		fmt.Fprintf(s.options.Progress, "Using %v of %v (commit %v)\n", ref, s.repo.GitRepo, commit)
+	}
+
+	if s.repo.LFS {
+		if s.options.Offline {
+			printProgress(s.options.Progress, "Warning: Git LFS files in %v can't be fetched while offline", s.repo.GitRepo)
+		} else if err = pullLFS(s.options.fetchContext(), repository, dest, s.repo.GitRepo); err != nil {
+			printProgress(s.options.Progress, "Warning: unable to fetch Git LFS files in %v: %v", s.repo.GitRepo, err)
+		}
+	}
+	if pointers, err := findLFSPointers(dest); err == nil && len(pointers) > 0 {
+		hint := ""
+		if !s.repo.LFS {
+			hint = " - set `lfs: true` in the scaffold's manifest entry to fetch them"
+		}
+		printProgress(s.options.Progress, "Warning: %d files are unresolved Git LFS pointers, e.g. %v%v", len(pointers), pointers[0], hint)
+	}
+	// submodules are fetched last, as they check their own LFS files
+	if s.repo.Submodules {
+		if err = s.fetchSubmodules(repository, commit, dest, sparseDirs); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(filepath.Join(dest, ".git"))
+}
+
+// localSource copies a scaffold from a directory on disk, e.g. a scaffold author's working copy
+type localSource struct {
+	path string
+}
+
+func newLocalSource(path string, options SourceOptions) (*localSource, error) {
+	if options.Ref != "" {
+		return nil, errors.New("a ref cannot be used with a local directory scaffold")
+	}
+	return &localSource{path: path}, nil
+}
+
+func (s *localSource) String() string {
+	return s.path
+}
+
+func (s *localSource) Fetch(dest string) error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%v is not a directory", s.path)
+	}
+	return cp.Copy(s.path, dest, cp.Options{
+		Skip: func(srcinfo os.FileInfo, src, dest string) (bool, error) {
+			return srcinfo.IsDir() && srcinfo.Name() == ".git", nil
+		},
+	})
+}
+
+func cleanSubdir(subdir string) (string, error) {
+	cleaned := filepath.ToSlash(filepath.Clean(subdir))
+	if filepath.IsAbs(subdir) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid subdir `%v` - it must be a relative path within the scaffold", subdir)
+	}
+	return cleaned, nil
+}
+
+// subdirSource treats a single subdirectory of another source as the scaffold, so that one
+// repository (or archive) can hold many scaffolds
+type subdirSource struct {
+	source Source
+	subdir string
+}
+
+func (s *subdirSource) String() string {
+	return s.source.String() + " (" + s.subdir + ")"
+}
+
+func (s *subdirSource) Fetch(dest string) error {
+	staging, err := os.MkdirTemp("", "lagoon-scaffold-subdir")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	if err = s.source.Fetch(staging); err != nil {
+		return err
+	}
+
+	root := filepath.Join(staging, filepath.FromSlash(s.subdir))
+	info, err := os.Stat(root)
+	if err != nil || !info.IsDir() {
+		return fmt.Errorf("subdir `%v` does not exist in %v", s.subdir, s.source)
+	}
+	return cp.Copy(root, dest)
+}
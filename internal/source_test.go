@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSource(t *testing.T) {
+	gitDir, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	plainDir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		repo     ScaffoldRepo
+		options  SourceOptions
+		wantType Source
+		wantErr  bool
+	}{
+		{"git url", ScaffoldRepo{GitRepo: "https://github.com/example/scaffold.git"}, SourceOptions{}, &gitSource{}, false},
+		{"file url to a git repository", ScaffoldRepo{GitRepo: "file://" + gitDir}, SourceOptions{}, &gitSource{}, false},
+		{"file url to a plain directory", ScaffoldRepo{GitRepo: "file://" + plainDir}, SourceOptions{}, &localSource{}, false},
+		{"path", ScaffoldRepo{Path: plainDir}, SourceOptions{}, &localSource{}, false},
+		{"path with a ref", ScaffoldRepo{Path: plainDir}, SourceOptions{Ref: "main"}, nil, true},
+		{"nothing to fetch", ScaffoldRepo{Name: "empty"}, SourceOptions{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSource(tt.repo, tt.options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			switch tt.wantType.(type) {
+			case *gitSource:
+				if _, ok := got.(*gitSource); !ok {
+					t.Errorf("NewSource() got = %T, want *gitSource", got)
+				}
+			case *localSource:
+				if _, ok := got.(*localSource); !ok {
+					t.Errorf("NewSource() got = %T, want *localSource", got)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceFetch(t *testing.T) {
+	gitDir, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+
+	for name, repo := range map[string]ScaffoldRepo{
+		"git":   {GitRepo: "file://" + gitDir},
+		"local": {Path: gitDir},
+	} {
+		t.Run(name, func(t *testing.T) {
+			source, err := NewSource(repo, SourceOptions{})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			dest := t.TempDir()
+			if err = source.Fetch(dest); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			if _, err = os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+				t.Errorf("Fetch() didn't produce .lagoon/flow.yml: %v", err)
+			}
+			if _, err = os.Stat(filepath.Join(dest, ".git")); !os.IsNotExist(err) {
+				t.Errorf("Fetch() should not leave a .git directory in the scaffold")
+			}
+		})
+	}
+}
+
+func TestSubdirSourceFetch(t *testing.T) {
+	monorepo, hashes := newTestRepository(t, []map[string]string{
+		{
+			"scaffolds/drupal/.lagoon/flow.yml":  "questions: []",
+			"scaffolds/drupal/README.md":         "drupal v1",
+			"scaffolds/laravel/.lagoon/flow.yml": "questions: []",
+			"README.md":                          "monorepo",
+		},
+		{"scaffolds/drupal/README.md": "drupal v2"},
+	}, nil)
+
+	tests := []struct {
+		name       string
+		repo       ScaffoldRepo
+		wantReadme string
+		wantErr    bool
+	}{
+		{"git sparse checkout", ScaffoldRepo{GitRepo: "file://" + monorepo, Subdir: "scaffolds/drupal"}, "drupal v2", false},
+		{"git pinned commit", ScaffoldRepo{GitRepo: "file://" + monorepo, Commit: hashes[0].String(), Subdir: "scaffolds/drupal/"}, "drupal v1", false},
+		{"local directory", ScaffoldRepo{Path: monorepo, Subdir: "scaffolds/drupal"}, "drupal v2", false},
+		{"missing subdir", ScaffoldRepo{Path: monorepo, Subdir: "scaffolds/rails"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(tt.repo, SourceOptions{})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			dest := t.TempDir()
+			err = source.Fetch(dest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Fetch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got, _ := os.ReadFile(filepath.Join(dest, "README.md"))
+			if string(got) != tt.wantReadme {
+				t.Errorf("Fetch() README.md = %v, want %v", string(got), tt.wantReadme)
+			}
+			if _, err = os.Stat(filepath.Join(dest, ".lagoon", "flow.yml")); err != nil {
+				t.Errorf("Fetch() didn't produce .lagoon/flow.yml: %v", err)
+			}
+			if _, err = os.Stat(filepath.Join(dest, "scaffolds")); !os.IsNotExist(err) {
+				t.Errorf("Fetch() should only copy the subdir")
+			}
+		})
+	}
+
+	for _, invalid := range []string{"../outside", "/abs", "."} {
+		if _, err := NewSource(ScaffoldRepo{Path: monorepo, Subdir: invalid}, SourceOptions{}); err == nil {
+			t.Errorf("NewSource() with subdir %q expected an error", invalid)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	cp "github.com/otiai10/copy"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// submodule.go fetches the submodules of scaffolds that opt in with `submodules: true`. Each submodule is fetched
+// as a git scaffold in its own right, so it benefits from the same auth, url rewriting and caching as the scaffold itself.
+
+// fetchSubmodules fetches each submodule of the given commit into dest, at the commit recorded for it.
+// With sparseDirs, only submodules within them are fetched.
+func (s *gitSource) fetchSubmodules(repository *git.Repository, hash plumbing.Hash, dest string, sparseDirs []string) error {
+	commit, err := repository.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	file, err := commit.File(".gitmodules")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return err
+	}
+	modules := config.NewModules()
+	if err = modules.Unmarshal([]byte(contents)); err != nil {
+		return fmt.Errorf("unable to parse .gitmodules: %w", err)
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range modules.Submodules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	options := s.options
+	options.Ref = ""
+	for _, name := range names {
+		submodule := modules.Submodules[name]
+		path, err := cleanSubdir(submodule.Path)
+		if err != nil {
+			return fmt.Errorf("submodule %v: %w", name, err)
+		}
+		if !inSparseDirs(path, sparseDirs) {
+			continue
+		}
+		entry, err := tree.FindEntry(path)
+		if err != nil || entry.Mode != filemode.Submodule {
+			return fmt.Errorf("submodule %v is not in commit %v", name, hash)
+		}
+
+		// submodule urls come from the scaffold itself, so they're only ever fetched as git remotes - and, as with
+		// git's protocol.file.allow=user, only a scaffold that is itself local may have submodules on this machine
+		url := options.Rewriter.Rewrite(resolveSubmoduleUrl(s.repo.GitRepo, submodule.URL))
+		if isLocalGitUrl(url) && !isLocalGitUrl(s.repo.GitRepo) {
+			return fmt.Errorf("submodule %v: %v is on the local filesystem, which is only allowed for local scaffolds", name, url)
+		}
+		source := &gitSource{repo: ScaffoldRepo{
+			Name:       s.repo.Name + "/" + name,
+			Source:     s.repo.Source,
+			GitRepo:    url,
+			Commit:     entry.Hash.String(),
+			Submodules: true,
+			LFS:        s.repo.LFS,
+		}, options: options}
+		if err = fetchInto(source, filepath.Join(dest, filepath.FromSlash(path))); err != nil {
+			return fmt.Errorf("unable to fetch submodule %v: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// fetchInto fetches source into target, replacing the empty directory left for a submodule by checkout
+func fetchInto(source Source, target string) error {
+	staging, err := os.MkdirTemp("", "lagoon-scaffold-submodule")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err = source.Fetch(staging); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(target); err != nil {
+		return err
+	}
+	return cp.Copy(staging, target)
+}
+
+// isLocalGitUrl is true for file:// urls and paths, which are cloned from the local filesystem
+func isLocalGitUrl(url string) bool {
+	endpoint, err := transport.NewEndpoint(url)
+	return err != nil || endpoint.Protocol == "file"
+}
+
+func inSparseDirs(path string, sparseDirs []string) bool {
+	if len(sparseDirs) == 0 {
+		return true
+	}
+	for _, dir := range sparseDirs {
+		if path == dir || strings.HasPrefix(path, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSubmoduleUrl resolves a submodule url relative to its superproject's, as git does -
+// e.g. ../other.git in https://github.com/org/repo.git is https://github.com/org/other.git
+func resolveSubmoduleUrl(base string, url string) string {
+	if !strings.HasPrefix(url, "./") && !strings.HasPrefix(url, "../") {
+		return url
+	}
+	base = strings.TrimSuffix(base, "/")
+	separator := "/"
+	for {
+		if rest, found := strings.CutPrefix(url, "./"); found {
+			url = rest
+		} else if rest, found := strings.CutPrefix(url, "../"); found {
+			url = rest
+			if i := strings.LastIndexAny(base, "/:"); i != -1 {
+				separator, base = string(base[i]), base[:i]
+			}
+		} else {
+			break
+		}
+	}
+	return base + separator + url
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSubmoduleUrl(t *testing.T) {
+	tests := []struct {
+		base string
+		url  string
+		want string
+	}{
+		{"https://github.com/org/repo.git", "https://github.com/other/shared.git", "https://github.com/other/shared.git"},
+		{"https://github.com/org/repo.git", "../shared.git", "https://github.com/org/shared.git"},
+		{"https://github.com/org/repo.git", "../../other/shared.git", "https://github.com/other/shared.git"},
+		{"https://github.com/org/repo.git/", "./shared.git", "https://github.com/org/repo.git/shared.git"},
+		{"git@github.com:org/repo.git", "../shared.git", "git@github.com:org/shared.git"},
+		{"git@github.com:org/repo.git", "../../other/shared.git", "git@github.com:other/shared.git"},
+		{"file:///srv/git/repo", "../shared", "file:///srv/git/shared"},
+	}
+	for _, tt := range tests {
+		if got := resolveSubmoduleUrl(tt.base, tt.url); got != tt.want {
+			t.Errorf("resolveSubmoduleUrl(%v, %v) got = %v, want %v", tt.base, tt.url, got, tt.want)
+		}
+	}
+}
+
+// runGit runs a git command in dir, failing the test if it fails
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "protocol.file.allow=always", "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+}
+
+func TestGitSourceSubmodules(t *testing.T) {
+	shared, _ := newTestRepository(t, []map[string]string{{"shared.txt": "shared"}}, nil)
+	scaffold, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	runGit(t, scaffold, "submodule", "add", "file://"+shared, "vendor/shared")
+	runGit(t, scaffold, "commit", "-m", "add submodule")
+	// later upstream commits shouldn't be used - only the commit recorded in the scaffold
+	os.WriteFile(filepath.Join(shared, "shared.txt"), []byte("newer"), 0644)
+	runGit(t, shared, "commit", "-am", "newer")
+
+	tests := []struct {
+		name    string
+		repo    ScaffoldRepo
+		options SourceOptions
+		want    string
+	}{
+		{"without submodules", ScaffoldRepo{GitRepo: "file://" + scaffold}, SourceOptions{}, ""},
+		{"with submodules", ScaffoldRepo{GitRepo: "file://" + scaffold, Submodules: true}, SourceOptions{}, "shared"},
+		{"with submodules via the cache", ScaffoldRepo{GitRepo: "file://" + scaffold, Submodules: true}, SourceOptions{Cache: NewRepoCache(t.TempDir())}, "shared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(tt.repo, tt.options)
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			dest := t.TempDir()
+			if err = source.Fetch(dest); err != nil {
+				t.Fatalf("Fetch() error = %v", err)
+			}
+			got, _ := os.ReadFile(filepath.Join(dest, "vendor", "shared", "shared.txt"))
+			if string(got) != tt.want {
+				t.Errorf("Fetch() got shared.txt = %q, want %q", got, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(dest, "vendor", "shared", ".git")); err == nil {
+				t.Errorf("Fetch() left the submodule's .git behind")
+			}
+		})
+	}
+}
+
+func TestGitSourceLocalSubmodules(t *testing.T) {
+	// a plain directory that a scaffold shouldn't be able to pull in, e.g. ~/.ssh
+	private := t.TempDir()
+	os.WriteFile(filepath.Join(private, "id_ed25519"), []byte("secret"), 0600)
+	shared, _ := newTestRepository(t, []map[string]string{{"shared.txt": "shared"}}, nil)
+
+	scaffold, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	runGit(t, scaffold, "submodule", "add", "file://"+shared, "vendor/shared")
+	runGit(t, scaffold, "commit", "-m", "add submodule")
+	hostile, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: []"}}, nil)
+	runGit(t, hostile, "submodule", "add", "file://"+shared, "vendor/keys")
+	runGit(t, hostile, "config", "-f", ".gitmodules", "submodule.vendor/keys.url", "file://"+private)
+	runGit(t, hostile, "commit", "-am", "add submodule")
+	server := newGitHTTPServer(t, filepath.Dir(scaffold), "", "")
+
+	tests := []struct {
+		name    string
+		gitRepo string
+		wantErr string
+	}{
+		{"remote scaffold with a local submodule", server.URL + "/" + filepath.Base(scaffold) + "/.git", "is on the local filesystem"},
+		{"local scaffold with a plain directory as a submodule", "file://" + hostile, "unable to fetch submodule vendor/keys"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := NewSource(ScaffoldRepo{GitRepo: tt.gitRepo, Submodules: true}, SourceOptions{})
+			if err != nil {
+				t.Fatalf("NewSource() error = %v", err)
+			}
+			dest := t.TempDir()
+			if err = source.Fetch(dest); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Fetch() error = %v, want %q", err, tt.wantErr)
+			}
+			if _, err = os.Stat(filepath.Join(dest, "vendor", "keys", "id_ed25519")); err == nil {
+				t.Errorf("Fetch() copied a local directory into the scaffold")
+			}
+		})
+	}
+}
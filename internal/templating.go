@@ -1,7 +1,12 @@
 package internal
 
 import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"text/template"
 )
 
@@ -12,8 +17,49 @@ var TemplatingExtensions = template.FuncMap{
 		matched, _ := regexp.MatchString(pattern, str)
 		return matched
 	},
+	"slugify": Slugify,
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slugify lowercases s, and replaces anything other than letters and numbers with single dashes -
+// e.g. "My Great Project!" becomes "my-great-project"
+func Slugify(s string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(s), "-"), "-")
 }
 
 func GetTemplate(name string) *template.Template {
 	return template.New(name).Funcs(TemplatingExtensions)
 }
+
+// ProcessTemplates renders every .lgtmpl file under dir with values, replacing each with the rendered file
+func ProcessTemplates(values interface{}, dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(p) == ".lgtmpl" {
+			templ, err := GetTemplate(filepath.Base(p)).ParseFiles(p)
+			if err != nil {
+				return err
+			}
+			var buf bytes.Buffer
+			err = templ.Execute(&buf, values)
+			if err != nil {
+				return err
+			}
+
+			outputName := strings.TrimSuffix(p, ".lgtmpl")
+			err = os.WriteFile(outputName, buf.Bytes(), 0644)
+			if err != nil {
+				return err
+			}
+			//remove the file from the temp dir
+			err = os.Remove(p)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -29,6 +29,25 @@ func TestRegexMatch(t *testing.T) {
 	}
 }
 
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{"My Great Project!", "my-great-project"},
+		{"  already-a-slug ", "already-a-slug"},
+		{"Drupal 10 -- Site", "drupal-10-site"},
+		{"under_scores.and.dots", "under-scores-and-dots"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if result := Slugify(test.input); result != test.expect {
+			t.Errorf("Slugify(%q) = %q; want %q", test.input, result, test.expect)
+		}
+	}
+}
+
 func TestGetTemplate(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -38,6 +57,7 @@ func TestGetTemplate(t *testing.T) {
 	}{
 		{"templateWithRegexMatch", "{{if regexMatch \"^hello\" .}}Matched!{{else}}No Match{{end}}", "hello world", "Matched!"},
 		{"templateWithRegexMatch", "{{if regexMatch \"^hello\" .}}Matched!{{else}}No Match{{end}}", "goodbye world", "No Match"},
+		{"templateWithSlugify", "{{slugify .}}", "Hello World", "hello-world"},
 	}
 
 	for _, test := range tests {
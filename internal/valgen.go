@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"github.com/AlecAivazis/survey/v2"
 	"gopkg.in/yaml.v2"
+	"slices"
+	"strconv"
+	"strings"
 )
 
 type surveyQuestion struct {
@@ -13,11 +16,44 @@ type surveyQuestion struct {
 	Required  bool             `yaml:"required"`
 	Help      string           `yaml:"help"`
 	Prompt    string           `yaml:"prompt"`
-	Default   string           `yaml:"default"`
+	Default   interface{}      `yaml:"default"` // typed to match the question, e.g. a bool for confirm questions
 	Options   []string         `yaml:"options"`
+	Validate  []validationRule `yaml:"validate,omitempty"`
+	When      string           `yaml:"when,omitempty"`       // only ask the question when this expression, over earlier answers, is true
+	Value     string           `yaml:"value,omitempty"`      // the template a computed question's value is rendered from
+	ValueType string           `yaml:"value_type,omitempty"` // what a computed value is converted to - string, bool or number
 	Questions []surveyQuestion `yaml:"questions,omitempty"`
 }
 
+// UnmarshalYAML keeps the defaults of questions answered with text exactly as written - yaml would otherwise
+// turn e.g. `default: no` into false, or `default: 0755` into 493
+func (q *surveyQuestion) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type plain surveyQuestion
+	if err := unmarshal((*plain)(q)); err != nil {
+		return err
+	}
+	if !q.hasTextAnswer() || q.Default == nil {
+		return nil
+	}
+	var raw struct {
+		Default string `yaml:"default"`
+	}
+	if err := unmarshal(&raw); err != nil {
+		return fmt.Errorf("question `%v` has an invalid default: %w", q.Name, err)
+	}
+	q.Default = raw.Default
+	return nil
+}
+
+// hasTextAnswer is true for questions answered with a string, i.e. text, select, password and editor questions
+func (q surveyQuestion) hasTextAnswer() bool {
+	switch q.Type {
+	case "confirm", "multiselect", "number", "conditional", "computed":
+		return false
+	}
+	return true
+}
+
 type surveyQuestionsFile struct {
 	Questions []surveyQuestion `yaml:"questions"`
 }
@@ -29,46 +65,147 @@ func UnmarshallSurveyQuestions(incoming []byte) ([]surveyQuestion, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = checkQuestions(incomingMap.Questions); err != nil {
+		return nil, err
+	}
 	return incomingMap.Questions, nil
 }
 
+// RunFromSurveyQuestions asks each question, or uses its default when not interactive - either way
+// the answers must satisfy the questions' `required` flags and `validate` rules
 func RunFromSurveyQuestions(questions []surveyQuestion, interactive bool) (interface{}, error) {
+	return RunFromSurveyQuestionsWithData(questions, interactive, NewFlowData("."))
+}
+
+// RunFromSurveyQuestionsWithData is RunFromSurveyQuestions, where templated defaults are rendered with data.
+// Defaults are rendered in the order questions are asked, so they can use any earlier answer.
+func RunFromSurveyQuestionsWithData(questions []surveyQuestion, interactive bool, data FlowData) (interface{}, error) {
+	return runSurveyQuestions(questions, interactive, true, nil, data)
+}
+
+// runSurveyQuestions only validates defaults when validate is set - the defaults of questions under
+// a conditional that was answered no aren't answers, so they aren't held to the rules.
+// parents holds the answers of any enclosing conditionals, for `when` expressions and templated defaults.
+func runSurveyQuestions(questions []surveyQuestion, interactive bool, validate bool, parents []interface{}, data FlowData) (map[string]interface{}, error) {
 	vals := make(map[string]interface{})
+	scopes := append(parents[:len(parents):len(parents)], vals)
 	for _, question := range questions {
+		if question.When != "" {
+			// questions that aren't asked are left out of the values altogether
+			ask, err := evaluateWhen(question.When, scopeLookup(scopes))
+			if err != nil {
+				return nil, fmt.Errorf("question `%v`: %w", question.Name, err)
+			}
+			if !ask {
+				continue
+			}
+		}
+		var def interface{}
+		if question.Type != "conditional" && question.Type != "computed" {
+			var err error
+			if def, err = question.resolveDefault(scopes, data); err != nil {
+				return nil, fmt.Errorf("question `%v` has an invalid default: %w", question.Name, err)
+			}
+		}
+		validator := survey.WithValidator(question.validator)
 		switch question.Type {
-		case "text":
-			textQuestion := &survey.Input{
+		case "text", "password", "editor":
+			var textQuestion survey.Prompt = &survey.Input{
 				Message: question.Prompt,
-				Default: question.Default,
+				Default: def.(string),
 				Help:    question.Help,
 			}
+			if question.Type == "password" {
+				// passwords aren't echoed, so neither is the default - leaving the answer empty uses it
+				textQuestion = &survey.Password{Message: question.Prompt, Help: question.Help}
+			} else if question.Type == "editor" {
+				textQuestion = &survey.Editor{
+					Message: question.Prompt, Default: def.(string), Help: question.Help, HideDefault: true, AppendDefault: true,
+				}
+			}
 			resp := ""
 			if interactive {
-				survey.AskOne(textQuestion, &resp, survey.WithValidator(survey.Required))
+				if question.Type == "password" {
+					validator = survey.WithValidator(question.defaultingValidator(def))
+				}
+				if err := survey.AskOne(textQuestion, &resp, validator); err != nil {
+					return nil, err
+				}
 			}
-			vals[question.Name] = question.Default
+			vals[question.Name] = def
 			if resp != "" {
 				vals[question.Name] = resp
 			}
 		case "select":
 			selectQuestion := &survey.Select{
-				Message: question.Prompt, Options: question.Options, Default: question.Default, Help: question.Help,
+				Message: question.Prompt, Options: question.Options, Default: def, Help: question.Help,
+			}
+			if def == "" {
+				selectQuestion.Default = nil
 			}
 			resp := ""
 			if interactive {
-				survey.AskOne(selectQuestion, &resp, survey.WithValidator(survey.Required))
+				if err := survey.AskOne(selectQuestion, &resp, validator); err != nil {
+					return nil, err
+				}
 			}
-			vals[question.Name] = question.Default
+			vals[question.Name] = def
 			if resp != "" {
 				vals[question.Name] = resp
 			}
+		case "confirm":
+			resp := def.(bool)
+			if interactive {
+				confirmQuestion := &survey.Confirm{Message: question.Prompt, Default: resp, Help: question.Help}
+				if err := survey.AskOne(confirmQuestion, &resp, validator); err != nil {
+					return nil, err
+				}
+			}
+			vals[question.Name] = resp
+		case "multiselect":
+			resp := def.([]string)
+			if interactive {
+				multiselectQuestion := &survey.MultiSelect{
+					Message: question.Prompt, Options: question.Options, Default: resp, Help: question.Help,
+				}
+				if err := survey.AskOne(multiselectQuestion, &resp, validator); err != nil {
+					return nil, err
+				}
+			}
+			vals[question.Name] = resp
+		case "number":
+			vals[question.Name] = def
+			if interactive {
+				numberQuestion := &survey.Input{Message: question.Prompt, Help: question.Help}
+				if def != nil {
+					numberQuestion.Default = fmt.Sprint(def)
+				}
+				resp := ""
+				if err := survey.AskOne(numberQuestion, &resp, validator); err != nil {
+					return nil, err
+				}
+				answer, err := question.typedValue(resp)
+				if err != nil {
+					return nil, err
+				}
+				vals[question.Name] = answer
+			}
+		case "computed":
+			// computed values are never asked for, just rendered from the answers before them
+			value, err := question.computedValue(scopes, data)
+			if err != nil {
+				return nil, fmt.Errorf("question `%v`: %w", question.Name, err)
+			}
+			vals[question.Name] = value
 		case "conditional": //This isn't strictly a survey question type, but it's a useful way to group questions
 			selectQuestion := &survey.Select{
 				Message: question.Prompt, Options: []string{"yes", "no"}, Default: "no", Help: question.Help,
 			}
 			resp := ""
 			if interactive {
-				survey.AskOne(selectQuestion, &resp, survey.WithValidator(survey.Required))
+				if err := survey.AskOne(selectQuestion, &resp, survey.WithValidator(survey.Required)); err != nil {
+					return nil, err
+				}
 			}
 
 			subinteractive := false
@@ -76,13 +213,13 @@ func RunFromSurveyQuestions(questions []surveyQuestion, interactive bool) (inter
 				subinteractive = true
 			}
 
-			subVals, err := RunFromSurveyQuestions(question.Questions, subinteractive)
+			subVals, err := runSurveyQuestions(question.Questions, subinteractive, validate && subinteractive, scopes, data)
 			if err != nil {
 				return nil, err
 			}
 
-			unwoundVals := subVals.(map[string]interface{})
-			for k, v := range subVals.(map[string]interface{}) {
+			unwoundVals := subVals
+			for k, v := range subVals {
 				unwoundVals[k] = v
 			}
 			unwoundVals["answer"] = subinteractive
@@ -92,6 +229,100 @@ func RunFromSurveyQuestions(questions []surveyQuestion, interactive bool) (inter
 		default:
 			return nil, errors.New(fmt.Sprintf("Unknown question type `%v` for question `%v`", question.Type, question.Name))
 		}
+		if validate && question.Type != "conditional" {
+			if err := question.validateAnswer(vals[question.Name]); err != nil {
+				return nil, fmt.Errorf("question `%v`: %w", question.Name, err)
+			}
+		}
 	}
 	return vals, nil
 }
+
+// typedValue converts a default, or an answer given as a string or decoded from yaml, into the type of
+// value the question produces - bool for confirm, []string for multiselect, int (or nil) for number,
+// and string for everything else
+func (q surveyQuestion) typedValue(value interface{}) (interface{}, error) {
+	switch q.Type {
+	case "confirm":
+		switch value := value.(type) {
+		case nil:
+			return false, nil
+		case bool:
+			return value, nil
+		case string:
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "", "n", "no", "false":
+				return false, nil
+			case "y", "yes", "true":
+				return true, nil
+			}
+		}
+		return nil, fmt.Errorf("`%v` is not yes or no", value)
+	case "number":
+		switch value := value.(type) {
+		case nil:
+			return nil, nil
+		case int:
+			return value, nil
+		case float64:
+			if value == float64(int(value)) {
+				return int(value), nil
+			}
+		case string:
+			if strings.TrimSpace(value) == "" {
+				return nil, nil
+			}
+			if number, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+				return number, nil
+			}
+		}
+		return nil, fmt.Errorf("`%v` is not a whole number", value)
+	case "multiselect":
+		var selected []string
+		switch value := value.(type) {
+		case nil:
+		case string:
+			if value != "" {
+				selected = []string{value}
+			}
+		case []string:
+			selected = value
+		case []interface{}:
+			for _, v := range value {
+				selected = append(selected, fmt.Sprint(v))
+			}
+		default:
+			return nil, fmt.Errorf("`%v` is not a list of options", value)
+		}
+		for _, option := range selected {
+			if !slices.Contains(q.Options, option) {
+				return nil, fmt.Errorf("`%v` is not one of the options", option)
+			}
+		}
+		if selected == nil {
+			selected = []string{}
+		}
+		return selected, nil
+	}
+	if value == nil {
+		return "", nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// scopeLookup resolves names in `when` expressions against the innermost scope that has them
+func scopeLookup(scopes []interface{}) func(path []string) interface{} {
+	return func(path []string) interface{} {
+		for i := len(scopes) - 1; i >= 0; i-- {
+			value, ok := lookupValue(scopes[i], path[0])
+			if !ok {
+				continue
+			}
+			for _, key := range path[1:] {
+				value, _ = lookupValue(value, key)
+			}
+			return value
+		}
+		return nil
+	}
+}
@@ -187,8 +187,10 @@ func Test_runFromSurveyQuestions(t *testing.T) {
 				interactive: false,
 			},
 			want: map[string]interface{}{
-				"conditional":                      false,
-				"conditional.conditional_question": "value",
+				"conditional": map[string]interface{}{
+					"answer":               false,
+					"conditional_question": "value",
+				},
 			},
 		},
 	}
@@ -205,3 +207,181 @@ func Test_runFromSurveyQuestions(t *testing.T) {
 		})
 	}
 }
+
+func TestRunFromSurveyQuestionsTypes(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: enable_solr
+  type: confirm
+  prompt: Enable Solr?
+  default: yes
+- name: use_varnish
+  type: confirm
+  prompt: Use Varnish?
+- name: services
+  type: multiselect
+  prompt: Which services should be enabled?
+  options: [redis, solr, varnish]
+  default: [redis, solr]
+- name: db_password
+  type: password
+  prompt: Database password
+  default: secret
+- name: php_memory
+  type: number
+  prompt: PHP memory limit (MB)
+  default: 256
+- name: replicas
+  type: number
+  prompt: Replicas
+- name: post_deploy
+  type: editor
+  prompt: Post deploy commands
+  default: |
+    drush cr
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RunFromSurveyQuestions(questions, false)
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestions() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"enable_solr": true,
+		"use_varnish": false,
+		"services":    []string{"redis", "solr"},
+		"db_password": "secret",
+		"php_memory":  256,
+		"replicas":    nil,
+		"post_deploy": "drush cr\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFromSurveyQuestions() got = %#v, want %#v", got, want)
+	}
+}
+
+func TestTypedValue(t *testing.T) {
+	tests := []struct {
+		question surveyQuestion
+		value    interface{}
+		want     interface{}
+		wantErr  bool
+	}{
+		{surveyQuestion{Type: "confirm"}, "Yes", true, false},
+		{surveyQuestion{Type: "confirm"}, "n", false, false},
+		{surveyQuestion{Type: "confirm"}, "maybe", nil, true},
+		{surveyQuestion{Type: "number"}, "512", 512, false},
+		{surveyQuestion{Type: "number"}, 2.0, 2, false},
+		{surveyQuestion{Type: "number"}, "1.5", nil, true},
+		{surveyQuestion{Type: "multiselect", Options: []string{"redis", "solr"}}, "redis", []string{"redis"}, false},
+		{surveyQuestion{Type: "multiselect", Options: []string{"redis", "solr"}}, nil, []string{}, false},
+		{surveyQuestion{Type: "multiselect", Options: []string{"redis", "solr"}}, []interface{}{"mongo"}, nil, true},
+		{surveyQuestion{Type: "text"}, 8080, "8080", false},
+	}
+	for _, tt := range tests {
+		got, err := tt.question.typedValue(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("typedValue(%#v) for a %v error = %v, wantErr %v", tt.value, tt.question.Type, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("typedValue(%#v) for a %v got = %#v, want %#v", tt.value, tt.question.Type, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshallSurveyQuestionsInvalidDefault(t *testing.T) {
+	flows := []string{
+		"questions:\n- name: a\n  type: number\n  default: lots\n",
+		"questions:\n- name: a\n  type: multiselect\n  options: [b]\n  default: [c]\n",
+		"questions:\n- name: a\n  type: select\n  options: [b]\n  default: c\n",
+		"questions:\n- name: a\n  type: text\n  default: [b]\n",
+	}
+	for _, flow := range flows {
+		if _, err := UnmarshallSurveyQuestions([]byte(flow)); err == nil {
+			t.Errorf("UnmarshallSurveyQuestions(%q) expected an error", flow)
+		}
+	}
+}
+
+func TestRunFromSurveyQuestionsTextDefaults(t *testing.T) {
+	// defaults are kept exactly as written, rather than as yaml would read them
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: solr
+  type: select
+  options: [yes, no]
+  default: no
+- name: xdebug
+  type: text
+  default: on
+- name: umask
+  type: password
+  default: 0755
+- name: php_version
+  type: editor
+  default: 1.10
+- name: debug
+  type: confirm
+  default: no
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RunFromSurveyQuestions(questions, false)
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestions() error = %v", err)
+	}
+	want := map[string]interface{}{"solr": "no", "xdebug": "on", "umask": "0755", "php_version": "1.10", "debug": false}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFromSurveyQuestions() got = %#v, want %#v", got, want)
+	}
+}
+
+func TestRunFromSurveyQuestionsWhen(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: database
+  type: select
+  options: [mariadb, postgres]
+  default: postgres
+- name: postgres_version
+  type: text
+  default: "14"
+  when: database == "postgres"
+- name: mariadb_version
+  type: text
+  required: true
+  when: database == "mariadb"
+- name: search
+  type: conditional
+  questions:
+  - name: backend
+    type: text
+    default: solr
+    when: database == "postgres"
+  - name: postgres_fts
+    type: confirm
+    when: backend == "postgres"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := RunFromSurveyQuestions(questions, false)
+	if err != nil {
+		t.Fatalf("RunFromSurveyQuestions() error = %v", err)
+	}
+	// skipped questions are left out, and aren't held to `required`
+	want := map[string]interface{}{
+		"database":         "postgres",
+		"postgres_version": "14",
+		"search": map[string]interface{}{
+			"answer":  false,
+			"backend": "solr",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("RunFromSurveyQuestions() got = %#v, want %#v", got, want)
+	}
+}
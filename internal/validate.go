@@ -0,0 +1,239 @@
+package internal
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// validate.go reports problems with a manifest in detail, with line numbers, for manifest authors.
+// We use yaml.v3 here purely for its node api, which keeps track of where everything came from.
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// scpLikeGitUrl matches git's scp style urls, e.g. git@github.com:org/repo.git
+var scpLikeGitUrl = regexp.MustCompile(`^[\w.-]+@[\w.-]+:[^/].*$`)
+
+type ManifestProblem struct {
+	Line     int
+	Scaffold string
+	Message  string
+}
+
+func (p ManifestProblem) String() string {
+	if p.Scaffold != "" {
+		return fmt.Sprintf("line %d: scaffold `%s`: %s", p.Line, p.Scaffold, p.Message)
+	}
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// yamlFields returns the yaml keys a struct accepts
+func yamlFields(v interface{}) map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// mappingFields returns the key and value nodes of a mapping in the order they appear, reporting duplicate keys
+func mappingFields(node *yamlv3.Node, scaffold string, problems *[]ManifestProblem) ([]*yamlv3.Node, map[string]*yamlv3.Node) {
+	var keys []*yamlv3.Node
+	seen := map[string]*yamlv3.Node{}
+	values := map[string]*yamlv3.Node{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if previous, exists := seen[key.Value]; exists {
+			*problems = append(*problems, ManifestProblem{key.Line, scaffold, fmt.Sprintf("duplicate key `%v` (first defined on line %d)", key.Value, previous.Line)})
+			continue
+		}
+		keys = append(keys, key)
+		seen[key.Value] = key
+		values[key.Value] = value
+	}
+	return keys, values
+}
+
+func isValidGitUrl(gitUrl string) bool {
+	if scpLikeGitUrl.MatchString(gitUrl) {
+		return true
+	}
+	parsed, err := url.Parse(gitUrl)
+	if err != nil {
+		return false
+	}
+	switch parsed.Scheme {
+	case "http", "https", "ssh", "git":
+		return parsed.Host != ""
+	case "file":
+		return parsed.Path != ""
+	}
+	return false
+}
+
+// ValidateManifest checks a manifest against the schema, returning every problem found
+func ValidateManifest(data []byte) []ManifestProblem {
+	var problems []ManifestProblem
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return []ManifestProblem{{Message: err.Error()}}
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return []ManifestProblem{{Line: doc.Line, Message: "manifest must be a mapping with a `scaffolds` list"}}
+	}
+
+	root := doc.Content[0]
+	keys, values := mappingFields(root, "", &problems)
+	allowed := yamlFields(ScaffoldLoader{})
+	for _, key := range keys {
+		if !allowed[key.Value] {
+			problems = append(problems, ManifestProblem{key.Line, "", fmt.Sprintf("unknown field `%v`", key.Value)})
+		}
+	}
+
+	if version, ok := values["version"]; ok {
+		var v int
+		if err := version.Decode(&v); err != nil || v < 1 {
+			problems = append(problems, ManifestProblem{version.Line, "", "version must be a positive integer"})
+		} else if v > ManifestSchemaVersion {
+			problems = append(problems, ManifestProblem{version.Line, "", fmt.Sprintf("version %d is newer than the supported version %d", v, ManifestSchemaVersion)})
+		}
+	}
+
+	scaffolds, ok := values["scaffolds"]
+	if !ok {
+		problems = append(problems, ManifestProblem{root.Line, "", "missing `scaffolds` list"})
+	} else if scaffolds.Kind != yamlv3.SequenceNode {
+		problems = append(problems, ManifestProblem{scaffolds.Line, "", "`scaffolds` must be a list"})
+	} else {
+		names := map[string]int{}
+		for _, entry := range scaffolds.Content {
+			problems = append(problems, validateScaffoldEntry(entry, names)...)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+func validateScaffoldEntry(entry *yamlv3.Node, names map[string]int) []ManifestProblem {
+	var problems []ManifestProblem
+	if entry.Kind != yamlv3.MappingNode {
+		return []ManifestProblem{{entry.Line, "", "scaffold entries must be mappings"}}
+	}
+
+	name := ""
+	for i := 0; i+1 < len(entry.Content); i += 2 {
+		if entry.Content[i].Value == "name" {
+			name = entry.Content[i+1].Value
+			break
+		}
+	}
+	keys, values := mappingFields(entry, name, &problems)
+
+	// decode only the first of any duplicated keys, which have already been reported
+	deduped := &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+	for _, key := range keys {
+		deduped.Content = append(deduped.Content, key, values[key.Value])
+	}
+	var repo ScaffoldRepo
+	if err := deduped.Decode(&repo); err != nil {
+		return append(problems, ManifestProblem{entry.Line, name, err.Error()})
+	}
+	problem := func(field string, message string) {
+		line := entry.Line
+		if value, ok := values[field]; ok {
+			line = value.Line
+		}
+		problems = append(problems, ManifestProblem{line, repo.Name, message})
+	}
+
+	allowed := yamlFields(ScaffoldRepo{})
+	for _, key := range keys {
+		if !allowed[key.Value] {
+			problems = append(problems, ManifestProblem{key.Line, repo.Name, fmt.Sprintf("unknown field `%v`", key.Value)})
+		}
+	}
+
+	if repo.Name == "" {
+		problem("name", "missing `name`")
+	} else if first, exists := names[repo.Name]; exists {
+		problem("name", fmt.Sprintf("duplicate name (first defined on line %d)", first))
+	} else {
+		names[repo.Name] = values["name"].Line
+	}
+	if strings.Contains(repo.Name, "/") {
+		problem("name", "names cannot contain `/`")
+	}
+
+	sources := 0
+	for _, field := range []string{repo.GitRepo, repo.Path, repo.Archive} {
+		if field != "" {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		problem("git_repo", "missing `git_repo` (or `path` or `archive`)")
+	case sources > 1:
+		problem("git_repo", "only one of `git_repo`, `path` and `archive` may be given")
+	}
+
+	if repo.GitRepo != "" {
+		if !isValidGitUrl(repo.GitRepo) {
+			problem("git_repo", fmt.Sprintf("invalid git url `%v`", repo.GitRepo))
+		}
+		if repo.Branch == "" && repo.Tag == "" && repo.Commit == "" && repo.Version == "" {
+			problem("git_repo", "missing ref - one of `branch`, `tag`, `commit` or `version` is required")
+		}
+	}
+	if (repo.Submodules || repo.LFS) && repo.GitRepo == "" {
+		problem("git_repo", "`submodules` and `lfs` can only be used with a `git_repo`")
+	}
+	if repo.HostKey != "" && !isValidHostKeyFingerprint(repo.HostKey) {
+		problem("host_key", "`host_key` must be a SHA256 fingerprint, as printed by `ssh-keygen -lf`")
+	}
+	if repo.Commit != "" && !commitPattern.MatchString(repo.Commit) {
+		problem("commit", fmt.Sprintf("invalid commit `%v`", repo.Commit))
+	}
+	if repo.Version != "" {
+		if _, err := ParseVersionConstraint(repo.Version); err != nil {
+			problem("version", err.Error())
+		}
+	}
+
+	if repo.Archive != "" {
+		if isRemoteLocation(repo.Archive) {
+			if parsed, err := url.Parse(repo.Archive); err != nil || parsed.Host == "" {
+				problem("archive", fmt.Sprintf("invalid archive url `%v`", repo.Archive))
+			}
+		}
+		if archiveFormat(repo.Archive) == "" {
+			problem("archive", "archives must be .tar.gz, .tgz or .zip")
+		}
+		if repo.SHA256 == "" {
+			problem("archive", "archives require a `sha256`")
+		}
+	}
+	if repo.SHA256 != "" && !sha256Pattern.MatchString(repo.SHA256) {
+		problem("sha256", "`sha256` must be 64 hex characters")
+	}
+
+	if repo.Subdir != "" {
+		if _, err := cleanSubdir(repo.Subdir); err != nil {
+			problem("subdir", err.Error())
+		}
+	}
+	return problems
+}
@@ -0,0 +1,94 @@
+package internal
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifest(t *testing.T) {
+	manifest := `version: 1
+scaffolds:
+  - name: good
+    git_repo: https://github.com/example/good.git
+    branch: main
+  - name: typo
+    gitrepo: https://github.com/example/typo.git
+    branch: main
+  - name: good
+    git_repo: git@github.com:example/good.git
+    tag: v1.0.0
+  - name: noref
+    git_repo: https://github.com/example/noref.git
+  - name: badurl
+    git_repo: "not a url"
+    branch: main
+  - name: archive
+    archive: https://example.com/scaffold.tar.gz
+  - name: dupkey
+    path: ./a
+    path: ./b
+  - name: hostkey
+    git_repo: git@git.example.com:example/hostkey.git
+    branch: main
+    host_key: 2048 MD5:aa:bb
+  - name: lfsarchive
+    archive: https://example.com/scaffold.tar.gz
+    sha256: 4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393
+    lfs: true
+`
+	want := []string{
+		"line 6: scaffold `typo`: missing `git_repo` (or `path` or `archive`)",
+		"line 7: scaffold `typo`: unknown field `gitrepo`",
+		"line 9: scaffold `good`: duplicate name (first defined on line 3)",
+		"line 13: scaffold `noref`: missing ref - one of `branch`, `tag`, `commit` or `version` is required",
+		"line 15: scaffold `badurl`: invalid git url `not a url`",
+		"line 18: scaffold `archive`: archives require a `sha256`",
+		"line 21: scaffold `dupkey`: duplicate key `path` (first defined on line 20)",
+		"line 25: scaffold `hostkey`: `host_key` must be a SHA256 fingerprint, as printed by `ssh-keygen -lf`",
+		"line 26: scaffold `lfsarchive`: `submodules` and `lfs` can only be used with a `git_repo`",
+	}
+
+	problems := ValidateManifest([]byte(manifest))
+	var got []string
+	for _, problem := range problems {
+		got = append(got, problem.String())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ValidateManifest() got =\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateManifestVersion(t *testing.T) {
+	problems := ValidateManifest([]byte("version: 99\nscaffolds: []\n"))
+	if len(problems) != 1 || problems[0].Line != 1 {
+		t.Errorf("ValidateManifest() with an unsupported version got = %v", problems)
+	}
+	if _, err := parseManifest("test", []byte("version: 99\nscaffolds: []\n")); err == nil {
+		t.Errorf("parseManifest() with an unsupported version expected an error")
+	}
+}
+
+func TestValidateManifestAssets(t *testing.T) {
+	for _, path := range []string{"./assets/scaffolds.yml", "./testassets/manifest_test_1.yml", "./testassets/manifest_test_2.yml"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := ValidateManifest(data); len(problems) > 0 {
+			t.Errorf("ValidateManifest(%v) got problems %v", path, problems)
+		}
+	}
+}
+
+func TestParseManifestStrict(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "scaffolds:\n  - name: a\n    gitrepo: https://github.com/example/a.git\n",
+		"duplicate name": "scaffolds:\n  - name: a\n    path: ./a\n  - name: a\n    path: ./b\n",
+	}
+	for name, manifest := range tests {
+		if _, err := parseManifest("test", []byte(manifest)); err == nil {
+			t.Errorf("parseManifest() with %v expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/AlecAivazis/survey/v2"
+	"regexp"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+)
+
+// valrules.go checks answers to flow questions against the question's `required` flag and `validate` rules,
+// whether they're typed in, loaded with --values or left as defaults.
+
+// validationRule is one of a question's `validate` rules. Every check given in a rule must pass - if one
+// doesn't, the rule's Message is shown, or a generated message if it has none.
+type validationRule struct {
+	Pattern      string   `yaml:"pattern,omitempty"`       // a regular expression the answer must match
+	MinLength    *int     `yaml:"min_length,omitempty"`    // in characters
+	MaxLength    *int     `yaml:"max_length,omitempty"`    // in characters
+	Min          *float64 `yaml:"min,omitempty"`           // the answer must be a number of at least Min
+	Max          *float64 `yaml:"max,omitempty"`           // the answer must be a number of at most Max
+	AllowedChars string   `yaml:"allowed_chars,omitempty"` // as in a regular expression character class, e.g. a-z0-9-
+	Message      string   `yaml:"message,omitempty"`
+}
+
+// compile checks the rule itself is sound, so broken flows are caught when they're loaded rather than when answered
+func (r validationRule) compile() error {
+	if r.Pattern != "" {
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if r.AllowedChars != "" {
+		if _, err := r.allowedCharsRegexp(); err != nil {
+			return fmt.Errorf("invalid allowed_chars: %w", err)
+		}
+	}
+	if r.MinLength != nil && r.MaxLength != nil && *r.MinLength > *r.MaxLength {
+		return errors.New("min_length is greater than max_length")
+	}
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return errors.New("min is greater than max")
+	}
+	return nil
+}
+
+func (r validationRule) allowedCharsRegexp() (*regexp.Regexp, error) {
+	return regexp.Compile("^[" + r.AllowedChars + "]*$")
+}
+
+// check returns the reason answer breaks the rule, if it does
+func (r validationRule) check(answer string) error {
+	failed := func(format string, args ...interface{}) error {
+		if r.Message != "" {
+			return errors.New(r.Message)
+		}
+		return fmt.Errorf(format, args...)
+	}
+	if r.Pattern != "" {
+		if matched, err := regexp.MatchString(r.Pattern, answer); err != nil || !matched {
+			return failed("must match the pattern %v", r.Pattern)
+		}
+	}
+	length := utf8.RuneCountInString(answer)
+	if r.MinLength != nil && length < *r.MinLength {
+		return failed("must be at least %d characters", *r.MinLength)
+	}
+	if r.MaxLength != nil && length > *r.MaxLength {
+		return failed("must be at most %d characters", *r.MaxLength)
+	}
+	if r.AllowedChars != "" {
+		if allowed, err := r.allowedCharsRegexp(); err != nil || !allowed.MatchString(answer) {
+			return failed("may only contain the characters %v", r.AllowedChars)
+		}
+	}
+	if r.Min != nil || r.Max != nil {
+		number, err := strconv.ParseFloat(answer, 64)
+		if err != nil {
+			return failed("must be a number")
+		}
+		if r.Min != nil && number < *r.Min {
+			return failed("must be at least %v", *r.Min)
+		}
+		if r.Max != nil && number > *r.Max {
+			return failed("must be at most %v", *r.Max)
+		}
+	}
+	return nil
+}
+
+// checkQuestions checks every question's validation rules, when expression, default and computed value,
+// including those under conditionals
+func checkQuestions(questions []surveyQuestion) error {
+	for _, question := range questions {
+		for _, rule := range question.Validate {
+			if err := rule.compile(); err != nil {
+				return fmt.Errorf("question `%v`: %w", question.Name, err)
+			}
+		}
+		if question.When != "" {
+			if _, err := parseWhen(question.When); err != nil {
+				return fmt.Errorf("question `%v` has an invalid when `%v`: %w", question.Name, question.When, err)
+			}
+		}
+		if err := question.checkComputed(); err != nil {
+			return err
+		}
+		if isTemplatedDefault(question.Default) {
+			// templated defaults can only be checked once they're rendered
+			if _, err := GetTemplate(question.Name).Parse(question.Default.(string)); err != nil {
+				return fmt.Errorf("question `%v` has an invalid default: %w", question.Name, err)
+			}
+		} else if question.Type != "conditional" && question.Type != "computed" {
+			def, err := question.typedValue(question.Default)
+			if err != nil {
+				return fmt.Errorf("question `%v` has an invalid default: %w", question.Name, err)
+			}
+			if question.Type == "select" && def != "" && !slices.Contains(question.Options, def.(string)) {
+				return fmt.Errorf("question `%v` has an invalid default: `%v` is not one of the options", question.Name, def)
+			}
+		}
+		if err := checkQuestions(question.Questions); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAnswer checks a typed answer against the question's requirements. Empty answers to optional questions
+// aren't checked against the rules, so that they can be left blank. Each option selected in a multiselect
+// is checked against the rules, and a required multiselect needs at least one.
+func (q surveyQuestion) validateAnswer(answer interface{}) error {
+	var values []string
+	switch answer := answer.(type) {
+	case nil:
+	case []string:
+		values = answer
+	default:
+		if value := fmt.Sprint(answer); value != "" {
+			values = []string{value}
+		}
+	}
+	if len(values) == 0 {
+		if q.Required && q.Type == "multiselect" {
+			return errors.New("at least one option must be selected")
+		}
+		if q.Required {
+			return errors.New("a value is required")
+		}
+		return nil
+	}
+	for _, value := range values {
+		for _, rule := range q.Validate {
+			if err := rule.check(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validator adapts validateAnswer for survey prompts
+func (q surveyQuestion) validator(answer interface{}) error {
+	switch a := answer.(type) {
+	case survey.OptionAnswer:
+		answer = a.Value
+	case []survey.OptionAnswer:
+		selected := []string{}
+		for _, option := range a {
+			selected = append(selected, option.Value)
+		}
+		answer = selected
+	}
+	typed, err := q.typedValue(answer)
+	if err != nil {
+		return err
+	}
+	return q.validateAnswer(typed)
+}
+
+// defaultingValidator validates def in place of an empty answer, for prompts that can't show their default
+func (q surveyQuestion) defaultingValidator(def interface{}) survey.Validator {
+	return func(answer interface{}) error {
+		if answer == "" {
+			answer = def
+		}
+		return q.validator(answer)
+	}
+}
+
+// ValidateValues checks values, e.g. loaded with --values, against every question's requirements. Computed values
+// are filled in as it goes, in the order the questions would be asked, so that later `when` expressions and computed
+// values see them just as they would when running the flow - any computed values already in values are replaced.
+// Questions under a conditional are only checked if the conditional was answered yes, and questions
+// whose `when` is false aren't checked at all.
+func ValidateValues(questions []surveyQuestion, values interface{}, data FlowData) error {
+	var problems []error
+	validateValues(questions, []interface{}{values}, true, data, &problems)
+	return errors.Join(problems...)
+}
+
+// validateValues only checks answers when validate is set, as with runSurveyQuestions, but always fills in computed values
+func validateValues(questions []surveyQuestion, scopes []interface{}, validate bool, data FlowData, problems *[]error) {
+	values := scopes[len(scopes)-1]
+	for _, question := range questions {
+		if question.When != "" {
+			ask, err := evaluateWhen(question.When, scopeLookup(scopes))
+			if err != nil {
+				*problems = append(*problems, fmt.Errorf("question `%v`: %w", question.Name, err))
+			}
+			if !ask {
+				continue
+			}
+		}
+		value, answered := lookupValue(values, question.Name)
+		switch question.Type {
+		case "computed":
+			computed, err := question.computedValue(scopes, data)
+			if err == nil {
+				err = setValue(values, question.Name, computed)
+			}
+			if err != nil {
+				*problems = append(*problems, fmt.Errorf("question `%v`: %w", question.Name, err))
+			}
+			continue
+		case "conditional":
+			if answered {
+				answer, _ := lookupValue(value, "answer")
+				validateValues(question.Questions, append(scopes[:len(scopes):len(scopes)], value), validate && answer == true, data, problems)
+			}
+			continue
+		}
+		if !validate {
+			continue
+		}
+		typed, err := question.typedValue(value)
+		if err == nil {
+			err = question.validateAnswer(typed)
+		}
+		if err != nil {
+			*problems = append(*problems, fmt.Errorf("question `%v`: %w", question.Name, err))
+		}
+	}
+}
+
+// lookupValue finds key in values, which may have been decoded from yaml or built by RunFromSurveyQuestions
+func lookupValue(values interface{}, key string) (interface{}, bool) {
+	switch values := values.(type) {
+	case map[string]interface{}:
+		value, ok := values[key]
+		return value, ok
+	case map[interface{}]interface{}:
+		value, ok := values[key]
+		return value, ok
+	}
+	return nil, false
+}
+
+// setValue sets key in values, which may have been decoded from yaml
+func setValue(values interface{}, key string, value interface{}) error {
+	switch values := values.(type) {
+	case map[string]interface{}:
+		values[key] = value
+	case map[interface{}]interface{}:
+		values[key] = value
+	default:
+		return errors.New("values are not a map")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package internal
+
+import (
+	"gopkg.in/yaml.v2"
+	"strings"
+	"testing"
+)
+
+func intPtr(i int) *int           { return &i }
+func floatPtr(f float64) *float64 { return &f }
+
+func TestValidationRuleCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   validationRule
+		answer string
+		want   string
+	}{
+		{"pattern matches", validationRule{Pattern: "^[a-z]+$"}, "myproject", ""},
+		{"pattern fails", validationRule{Pattern: "^[a-z]+$"}, "My Project", "must match the pattern ^[a-z]+$"},
+		{"min length", validationRule{MinLength: intPtr(3)}, "ab", "must be at least 3 characters"},
+		{"max length counts characters", validationRule{MaxLength: intPtr(4)}, "café", ""},
+		{"max length", validationRule{MaxLength: intPtr(4)}, "cafés", "must be at most 4 characters"},
+		{"allowed chars", validationRule{AllowedChars: "a-z0-9-"}, "my-project-1", ""},
+		{"disallowed chars", validationRule{AllowedChars: "a-z0-9-"}, "my_project", "may only contain the characters a-z0-9-"},
+		{"in range", validationRule{Min: floatPtr(128), Max: floatPtr(2048)}, "512", ""},
+		{"below min", validationRule{Min: floatPtr(128)}, "64", "must be at least 128"},
+		{"above max", validationRule{Max: floatPtr(10)}, "11", "must be at most 10"},
+		{"not a number", validationRule{Min: floatPtr(1)}, "lots", "must be a number"},
+		{"custom message", validationRule{Pattern: "^[a-z]+$", Message: "Use lowercase letters only"}, "ABC", "Use lowercase letters only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if err := tt.rule.check(tt.answer); err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("check(%q) got = %q, want %q", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshallSurveyQuestionsInvalidRules(t *testing.T) {
+	tests := map[string]string{
+		"bad pattern":       "questions:\n- name: a\n  type: text\n  validate:\n  - pattern: '[a-z'\n",
+		"bad allowed chars": "questions:\n- name: a\n  type: text\n  validate:\n  - allowed_chars: 'z-a'\n",
+		"min above max":     "questions:\n- name: a\n  type: text\n  validate:\n  - min: 10\n    max: 1\n",
+		"nested":            "questions:\n- name: c\n  type: conditional\n  questions:\n  - name: a\n    type: text\n    validate:\n    - min_length: 5\n      max_length: 2\n",
+	}
+	for name, flow := range tests {
+		if _, err := UnmarshallSurveyQuestions([]byte(flow)); err == nil {
+			t.Errorf("UnmarshallSurveyQuestions() with %v expected an error", name)
+		}
+	}
+}
+
+const validatedFlow = `
+questions:
+- name: project_name
+  type: text
+  required: true
+  default: myproject
+  validate:
+  - pattern: ^[a-z]
+    message: The project name must start with a letter
+  - allowed_chars: a-z0-9-
+- name: php_memory
+  type: text
+  validate:
+  - min: 128
+    max: 2048
+- name: redis
+  type: conditional
+  questions:
+  - name: redis_version
+    type: text
+    required: true
+`
+
+func TestRunFromSurveyQuestionsValidatesDefaults(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(validatedFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the redis conditional defaults to no, so its required question isn't a problem
+	if _, err = RunFromSurveyQuestions(questions, false); err != nil {
+		t.Errorf("RunFromSurveyQuestions() error = %v", err)
+	}
+
+	questions[0].Default = "1project"
+	_, err = RunFromSurveyQuestions(questions, false)
+	if err == nil || err.Error() != "question `project_name`: The project name must start with a letter" {
+		t.Errorf("RunFromSurveyQuestions() with an invalid default got error = %v", err)
+	}
+
+	questions[0].Default = ""
+	_, err = RunFromSurveyQuestions(questions, false)
+	if err == nil || err.Error() != "question `project_name`: a value is required" {
+		t.Errorf("RunFromSurveyQuestions() with no default for a required question got error = %v", err)
+	}
+}
+
+func TestValidateValues(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(validatedFlow))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		values string
+		want   []string
+	}{
+		{"valid", "project_name: my-project\nphp_memory: 512\n", nil},
+		{"optional questions can be left out", "project_name: my-project\n", nil},
+		{"declined conditional", "project_name: my-project\nredis:\n  answer: false\n", nil},
+		{"accepted conditional", "project_name: my-project\nredis:\n  answer: true\n  redis_version: \"7\"\n", nil},
+		{"problems", "project_name: My_Project\nphp_memory: 64\nredis:\n  answer: true\n", []string{
+			"question `project_name`: The project name must start with a letter",
+			"question `php_memory`: must be at least 128",
+			"question `redis_version`: a value is required",
+		}},
+		{"missing required value", "php_memory: 256\n", []string{"question `project_name`: a value is required"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var values interface{}
+			if err := yaml.Unmarshal([]byte(tt.values), &values); err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if err := ValidateValues(questions, values, FlowData{}); err != nil {
+				got = err.Error()
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("ValidateValues() got =\n%v\nwant\n%v", got, want)
+			}
+		})
+	}
+}
+
+func TestValidateValuesTypes(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: services
+  type: multiselect
+  required: true
+  options: [redis, solr]
+- name: replicas
+  type: number
+  validate:
+  - min: 1
+    max: 5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		values string
+		want   string
+	}{
+		{"services: [redis]\nreplicas: 2\n", ""},
+		{"services: []\n", "question `services`: at least one option must be selected"},
+		{"services: [mongo]\n", "question `services`: `mongo` is not one of the options"},
+		{"services: [solr]\nreplicas: two\n", "question `replicas`: `two` is not a whole number"},
+		{"services: [solr]\nreplicas: 9\n", "question `replicas`: must be at most 5"},
+	}
+	for _, tt := range tests {
+		var values interface{}
+		if err := yaml.Unmarshal([]byte(tt.values), &values); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := ValidateValues(questions, values, FlowData{}); err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("ValidateValues(%q) got = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestValidateValuesWhen(t *testing.T) {
+	questions, err := UnmarshallSurveyQuestions([]byte(`
+questions:
+- name: database
+  type: select
+  options: [mariadb, postgres]
+- name: postgres_version
+  type: text
+  required: true
+  when: database == "postgres"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for values, want := range map[string]string{
+		"database: mariadb\n":                            "",
+		"database: postgres\npostgres_version: \"14\"\n": "",
+		"database: postgres\n":                           "question `postgres_version`: a value is required",
+	} {
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(values), &parsed); err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := ValidateValues(questions, parsed, FlowData{}); err != nil {
+			got = err.Error()
+		}
+		if got != want {
+			t.Errorf("ValidateValues(%q) got = %q, want %q", values, got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// verify.go runs every scaffold in a manifest end to end, non-interactively, to catch broken scaffolds
+// before users do.
+
+// VerifyStages are the checks made against each scaffold, in order. Once a stage fails, later ones are skipped.
+var VerifyStages = []string{"fetch", "flow", "run", "templates"}
+
+type VerifyResult struct {
+	Scaffold ScaffoldRepo
+	// Reached is the number of stages that were run
+	Reached int
+	// Err is the error from the stage that failed, if any
+	Err error
+}
+
+func (r VerifyResult) Passed() bool {
+	return r.Err == nil
+}
+
+// StageStatus returns PASS, FAIL or SKIP for the stage at index i
+func (r VerifyResult) StageStatus(i int) string {
+	switch {
+	case i >= r.Reached:
+		return "SKIP"
+	case i == r.Reached-1 && r.Err != nil:
+		return "FAIL"
+	}
+	return "PASS"
+}
+
+// VerifyScaffold fetches a scaffold, parses and runs its flow with default values, and renders its templates
+func VerifyScaffold(repo ScaffoldRepo, options SourceOptions) VerifyResult {
+	result := VerifyResult{Scaffold: repo}
+	stage := func(err error) bool {
+		result.Reached++
+		result.Err = err
+		return err == nil
+	}
+
+	dir, err := os.MkdirTemp("", "lagoon-scaffold-verify")
+	if err != nil {
+		stage(err)
+		return result
+	}
+	defer os.RemoveAll(dir)
+
+	source, err := NewSource(repo, options)
+	if err == nil {
+		err = source.Fetch(dir)
+	}
+	if !stage(err) {
+		return result
+	}
+
+	rawYaml, err := os.ReadFile(filepath.Join(dir, ".lagoon", "flow.yml"))
+	var questions []surveyQuestion
+	if err == nil {
+		questions, err = UnmarshallSurveyQuestions(rawYaml)
+	}
+	if !stage(err) {
+		return result
+	}
+
+	values, err := RunFromSurveyQuestions(questions, false)
+	if !stage(err) {
+		return result
+	}
+
+	stage(ProcessTemplates(values, dir))
+	return result
+}
+
+// VerifyScaffolds verifies scaffolds concurrently, with at most workers running at once.
+// Results are returned in the same order as scaffolds.
+func VerifyScaffolds(scaffolds []ScaffoldRepo, options SourceOptions, workers int) []VerifyResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]VerifyResult, len(scaffolds))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = VerifyScaffold(scaffolds[i], options)
+			}
+		}()
+	}
+	for i := range scaffolds {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// FormatVerifyResults renders results as a pass/fail matrix, followed by the error for each failure
+func FormatVerifyResults(results []VerifyResult) string {
+	width := len("scaffold")
+	for _, result := range results {
+		if len(result.Scaffold.Name) > width {
+			width = len(result.Scaffold.Name)
+		}
+	}
+	out := fmt.Sprintf("%-*s", width, "scaffold")
+	for _, stage := range VerifyStages {
+		out += fmt.Sprintf("  %-9s", stage)
+	}
+	out += "\n"
+	for _, result := range results {
+		out += fmt.Sprintf("%-*s", width, result.Scaffold.Name)
+		for i := range VerifyStages {
+			out += fmt.Sprintf("  %-9s", result.StageStatus(i))
+		}
+		out += "\n"
+	}
+	for _, result := range results {
+		if !result.Passed() {
+			out += fmt.Sprintf("\n%s failed at %s: %v", result.Scaffold.Name, VerifyStages[result.Reached-1], result.Err)
+		}
+	}
+	return out
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyScaffolds(t *testing.T) {
+	flow := `questions:
+- name: projectName
+  type: text
+  prompt: Project name
+  default: my-project
+`
+	good, _ := newTestRepository(t, []map[string]string{{
+		".lagoon/flow.yml":          flow,
+		"docker-compose.yml.lgtmpl": "name: {{ .projectName }}",
+	}}, nil)
+	badFlow, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions: [unclosed"}}, nil)
+	badQuestion, _ := newTestRepository(t, []map[string]string{{".lagoon/flow.yml": "questions:\n- name: a\n  type: nonsense\n"}}, nil)
+	badTemplate, _ := newTestRepository(t, []map[string]string{{
+		".lagoon/flow.yml":  flow,
+		"broken.yml.lgtmpl": "{{ .projectName ",
+	}}, nil)
+
+	scaffolds := []ScaffoldRepo{
+		{Name: "good", GitRepo: "file://" + good},
+		{Name: "missing", GitRepo: "file://" + t.TempDir() + "/missing.git"},
+		{Name: "badFlow", GitRepo: "file://" + badFlow},
+		{Name: "badQuestion", GitRepo: "file://" + badQuestion},
+		{Name: "badTemplate", GitRepo: "file://" + badTemplate},
+		{Name: "goodLocal", Path: good},
+	}
+	wantReached := map[string]int{"good": 4, "missing": 1, "badFlow": 2, "badQuestion": 3, "badTemplate": 4, "goodLocal": 4}
+	wantPassed := map[string]bool{"good": true, "goodLocal": true}
+
+	results := VerifyScaffolds(scaffolds, SourceOptions{}, 3)
+	if len(results) != len(scaffolds) {
+		t.Fatalf("VerifyScaffolds() got %v results, want %v", len(results), len(scaffolds))
+	}
+	for i, result := range results {
+		name := scaffolds[i].Name
+		if result.Scaffold.Name != name {
+			t.Errorf("VerifyScaffolds() result %v is for %v, want %v", i, result.Scaffold.Name, name)
+		}
+		if result.Passed() != wantPassed[name] || result.Reached != wantReached[name] {
+			t.Errorf("%v: passed = %v, reached = %v, err = %v; want passed = %v, reached = %v", name, result.Passed(), result.Reached, result.Err, wantPassed[name], wantReached[name])
+		}
+	}
+
+	matrix := FormatVerifyResults(results)
+	for _, want := range []string{"badFlow      PASS       FAIL       SKIP", "badTemplate failed at templates"} {
+		if !strings.Contains(matrix, want) {
+			t.Errorf("FormatVerifyResults() = %v, want it to contain %q", matrix, want)
+		}
+	}
+}
@@ -0,0 +1,484 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// when.go evaluates the `when` expressions that decide whether a flow question is asked, e.g.
+//
+//	when: database == "postgres" && !(version in ["9", "10"])
+//
+// Names refer to earlier answers - those under a conditional with a dotted path, e.g. redis.answer.
+// Comparisons are ==, !=, <, <=, >, >= and `in` (a list, or a multiselect answer), combined with &&, || and !.
+
+type whenExpr interface {
+	eval(lookup func(path []string) interface{}) (interface{}, error)
+	String() string
+}
+
+type whenLiteral struct{ value interface{} }
+
+type whenName struct{ path []string }
+
+type whenList struct{ items []whenExpr }
+
+type whenNot struct{ operand whenExpr }
+
+type whenBinary struct {
+	op          string
+	left, right whenExpr
+}
+
+func (e whenLiteral) eval(func([]string) interface{}) (interface{}, error) { return e.value, nil }
+
+func (e whenLiteral) String() string {
+	if s, ok := e.value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(e.value)
+}
+
+func (e whenName) eval(lookup func([]string) interface{}) (interface{}, error) {
+	return lookup(e.path), nil
+}
+
+func (e whenName) String() string { return strings.Join(e.path, ".") }
+
+func (e whenList) eval(lookup func([]string) interface{}) (interface{}, error) {
+	var values []interface{}
+	for _, item := range e.items {
+		value, err := item.eval(lookup)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (e whenList) String() string {
+	var items []string
+	for _, item := range e.items {
+		items = append(items, item.String())
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func (e whenNot) eval(lookup func([]string) interface{}) (interface{}, error) {
+	value, err := e.operand.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	return !truthy(value), nil
+}
+
+func (e whenNot) String() string { return "!" + e.operand.String() }
+
+func (e whenBinary) eval(lookup func([]string) interface{}) (interface{}, error) {
+	left, err := e.left.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	// && and || short circuit, so later parts can assume earlier ones
+	switch {
+	case e.op == "&&" && !truthy(left):
+		return false, nil
+	case e.op == "||" && truthy(left):
+		return true, nil
+	}
+	right, err := e.right.eval(lookup)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&", "||":
+		return truthy(right), nil
+	case "==":
+		return whenEqual(left, right), nil
+	case "!=":
+		return !whenEqual(left, right), nil
+	case "in":
+		list := reflect.ValueOf(right)
+		if right == nil {
+			return false, nil
+		}
+		if list.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("`%v` is not a list", e.right)
+		}
+		for i := 0; i < list.Len(); i++ {
+			if whenEqual(left, list.Index(i).Interface()) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	l, lok := whenNumber(left)
+	r, rok := whenNumber(right)
+	if !lok || !rok {
+		// unanswered questions can't be compared, so don't match
+		if left == nil || right == nil {
+			return false, nil
+		}
+		return nil, fmt.Errorf("cannot compare %v %v %v - both must be numbers", e.left, e.op, e.right)
+	}
+	switch e.op {
+	case "<":
+		return l < r, nil
+	case "<=":
+		return l <= r, nil
+	case ">":
+		return l > r, nil
+	}
+	return l >= r, nil
+}
+
+func (e whenBinary) String() string {
+	return "(" + e.left.String() + " " + e.op + " " + e.right.String() + ")"
+}
+
+// truthy is false for false, nil, empty strings, zero, empty lists and conditionals answered no
+func truthy(value interface{}) bool {
+	if answer, ok := lookupValue(value, "answer"); ok {
+		return truthy(answer)
+	}
+	switch value := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case string:
+		return value != ""
+	}
+	if number, ok := whenNumber(value); ok {
+		return number != 0
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice || v.Kind() == reflect.Map {
+		return v.Len() > 0
+	}
+	return true
+}
+
+func whenNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case int:
+		return float64(value), true
+	case float64:
+		return value, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return number, err == nil && !math.IsInf(number, 0) && !math.IsNaN(number)
+	}
+	return 0, false
+}
+
+// isWhenNumber is true for actual numbers - number answers and unquoted numbers - rather than strings that look like them
+func isWhenNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, float64:
+		return true
+	}
+	return false
+}
+
+// whenEqual compares by value when either side is a number, so that `replicas == "2"` works for a number
+// question, and everything else by how it would be rendered in a template - two strings are only equal if
+// they're the same, so `php == "8.1"` doesn't match "8.10". An unanswered question equals "".
+// Booleans, e.g. confirm answers, also equal "yes" and "no".
+func whenEqual(left, right interface{}) bool {
+	_, lbool := left.(bool)
+	_, rbool := right.(bool)
+	if lbool || rbool {
+		l, lok := whenBool(left)
+		r, rok := whenBool(right)
+		if lok && rok {
+			return l == r
+		}
+	}
+	if isWhenNumber(left) || isWhenNumber(right) {
+		l, lok := whenNumber(left)
+		r, rok := whenNumber(right)
+		if lok && rok {
+			return l == r
+		}
+	}
+	render := func(value interface{}) string {
+		if value == nil {
+			return ""
+		}
+		return fmt.Sprint(value)
+	}
+	return render(left) == render(right)
+}
+
+func whenBool(value interface{}) (bool, bool) {
+	switch value := value.(type) {
+	case bool:
+		return value, true
+	case string:
+		switch value {
+		case "yes", "true":
+			return true, true
+		case "no", "false":
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// parseWhen parses a `when` expression
+func parseWhen(expression string) (whenExpr, error) {
+	tokens, err := tokenizeWhen(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &whenParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected `%v`", p.tokens[p.pos].text)
+	}
+	return expr, nil
+}
+
+// evaluateWhen is true when the expression is, with names resolved by lookup
+func evaluateWhen(expression string, lookup func(path []string) interface{}) (bool, error) {
+	expr, err := parseWhen(expression)
+	if err != nil {
+		return false, fmt.Errorf("invalid when `%v`: %w", expression, err)
+	}
+	value, err := expr.eval(lookup)
+	if err != nil {
+		return false, fmt.Errorf("unable to evaluate when `%v`: %w", expression, err)
+	}
+	return truthy(value), nil
+}
+
+// whenNames returns every name an expression refers to, e.g. to show what a question depends on
+func whenNames(expr whenExpr) []string {
+	switch expr := expr.(type) {
+	case whenName:
+		return []string{expr.String()}
+	case whenList:
+		var names []string
+		for _, item := range expr.items {
+			names = append(names, whenNames(item)...)
+		}
+		return names
+	case whenNot:
+		return whenNames(expr.operand)
+	case whenBinary:
+		return append(whenNames(expr.left), whenNames(expr.right)...)
+	}
+	return nil
+}
+
+type whenTokenKind int
+
+const (
+	whenTokenOperator whenTokenKind = iota
+	whenTokenName
+	whenTokenString
+	whenTokenNumber
+)
+
+type whenToken struct {
+	kind whenTokenKind
+	text string
+}
+
+func tokenizeWhen(expression string) ([]whenToken, error) {
+	var tokens []whenToken
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return nil, errors.New("unterminated string")
+			}
+			text := string(runes[i+1 : j])
+			if r == '"' {
+				unquoted, err := strconv.Unquote(string(runes[i : j+1]))
+				if err != nil {
+					return nil, fmt.Errorf("invalid string %v", string(runes[i:j+1]))
+				}
+				text = unquoted
+			}
+			tokens = append(tokens, whenToken{whenTokenString, text})
+			i = j + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, whenToken{whenTokenNumber, string(runes[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || runes[j] == '_' || runes[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, whenToken{whenTokenName, string(runes[i:j])})
+			i = j
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected `%c`", r)
+			}
+			tokens = append(tokens, whenToken{whenTokenOperator, operator})
+			i += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+type whenParser struct {
+	tokens []whenToken
+	pos    int
+}
+
+func (p *whenParser) peek() whenToken {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return whenToken{}
+}
+
+// accept consumes the next token if it's the operator (or keyword) given
+func (p *whenParser) accept(text string) bool {
+	if next := p.peek(); next.text == text && (next.kind == whenTokenOperator || next.kind == whenTokenName) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *whenParser) parseOr() (whenExpr, error) {
+	left, err := p.parseAnd()
+	for err == nil && p.accept("||") {
+		var right whenExpr
+		right, err = p.parseAnd()
+		left = whenBinary{op: "||", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *whenParser) parseAnd() (whenExpr, error) {
+	left, err := p.parseNot()
+	for err == nil && p.accept("&&") {
+		var right whenExpr
+		right, err = p.parseNot()
+		left = whenBinary{op: "&&", left: left, right: right}
+	}
+	return left, err
+}
+
+func (p *whenParser) parseNot() (whenExpr, error) {
+	if p.accept("!") {
+		operand, err := p.parseNot()
+		return whenNot{operand: operand}, err
+	}
+	return p.parseComparison()
+}
+
+func (p *whenParser) parseComparison() (whenExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if p.accept(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return whenBinary{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseOperand() (whenExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	switch token.kind {
+	case whenTokenString:
+		return whenLiteral{token.text}, nil
+	case whenTokenNumber:
+		number, err := strconv.ParseFloat(token.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %v", token.text)
+		}
+		return whenLiteral{number}, nil
+	case whenTokenName:
+		switch token.text {
+		case "true":
+			return whenLiteral{true}, nil
+		case "false":
+			return whenLiteral{false}, nil
+		case "yes", "no":
+			// strings, so they match select options of the same name - whenEqual also matches them to confirm answers
+			return whenLiteral{token.text}, nil
+		case "in":
+			return nil, errors.New("unexpected `in`")
+		}
+		path := strings.Split(token.text, ".")
+		for _, part := range path {
+			if part == "" {
+				return nil, fmt.Errorf("invalid name %v", token.text)
+			}
+		}
+		return whenName{path: path}, nil
+	}
+	switch token.text {
+	case "(":
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, errors.New("missing `)`")
+		}
+		return expr, nil
+	case "[":
+		list := whenList{}
+		for !p.accept("]") {
+			if len(list.items) > 0 && !p.accept(",") {
+				return nil, errors.New("missing `,` or `]`")
+			}
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, item)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected `%v`", token.text)
+}
@@ -0,0 +1,89 @@
+package internal
+
+import "testing"
+
+func TestEvaluateWhen(t *testing.T) {
+	answers := []interface{}{map[string]interface{}{
+		"database": "postgres",
+		"version":  "14",
+		"replicas": 2,
+		"services": []string{"redis", "solr"},
+		"solr":     false,
+		"xdebug":   "no", // a select with the options yes and no
+		"php":      "8.10",
+		"ratio":    "nan",
+		"redis":    map[string]interface{}{"answer": true, "redis_version": "7"},
+		"varnish":  map[string]interface{}{"answer": false},
+	}}
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{`database == "postgres"`, true},
+		{`database != 'postgres'`, false},
+		{`database == "mariadb" || database == "postgres"`, true},
+		{`database == "postgres" && version >= 13`, true},
+		{`database == "postgres" && !(version in ["13", "14"])`, false},
+		{`replicas > 1`, true},
+		{`replicas == "2"`, true},
+		{`"solr" in services`, true},
+		{`"varnish" in services`, false},
+		{`solr`, false},
+		{`!solr`, true},
+		{`redis`, true},
+		{`redis.redis_version == "7"`, true},
+		{`varnish`, false},
+		{`unanswered`, false},
+		{`unanswered == ""`, true},
+		{`unanswered > 1`, false},
+		{`"redis" in unanswered`, false},
+		{`solr == no`, true},
+		{`solr == false`, true},
+		{`solr == yes`, false},
+		{`xdebug == no`, true},
+		{`xdebug == "no"`, true},
+		{`xdebug == yes`, false},
+		{`xdebug == true`, false},
+		{`php == "8.10"`, true},
+		{`php == "8.1"`, false},
+		{`php == 8.1`, true},
+		{`"1.0" == "1"`, false},
+		{`1.0 == "1"`, true},
+		{`ratio == "nan"`, true},
+		{`php > 8`, true},
+	}
+	for _, tt := range tests {
+		got, err := evaluateWhen(tt.expression, scopeLookup(answers))
+		if err != nil {
+			t.Errorf("evaluateWhen(%v) error = %v", tt.expression, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("evaluateWhen(%v) got = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestParseWhenErrors(t *testing.T) {
+	for _, expression := range []string{
+		`database ==`,
+		`database = "postgres"`,
+		`(database == "postgres"`,
+		`database == "postgres`,
+		`version in ["13" "14"]`,
+		`database "postgres"`,
+	} {
+		if _, err := parseWhen(expression); err == nil {
+			t.Errorf("parseWhen(%v) expected an error", expression)
+		}
+	}
+}
+
+func TestEvaluateWhenErrors(t *testing.T) {
+	answers := []interface{}{map[string]interface{}{"database": "postgres"}}
+	for _, expression := range []string{`database > 1`, `"a" in database`} {
+		if _, err := evaluateWhen(expression, scopeLookup(answers)); err == nil {
+			t.Errorf("evaluateWhen(%v) expected an error", expression)
+		}
+	}
+}
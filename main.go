@@ -2,11 +2,21 @@ package main
 
 import (
 	"bomoko/lagoon-init/cmd"
+	"context"
 	"os"
+	"os/signal"
 )
 
 func main() {
-	err := cmd.RootCmd.Execute()
+	// cancel any in-flight requests on ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		// a second ctrl-c kills us outright, should anything not be cancelled
+		<-ctx.Done()
+		stop()
+	}()
+	err := cmd.RootCmd.ExecuteContext(ctx)
+	stop()
 	if err != nil {
 		os.Exit(1)
 	}